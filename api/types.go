@@ -2,8 +2,13 @@ package api
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/magicsong/kidecar/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
@@ -12,6 +17,9 @@ import (
 type Plugin interface {
 	Name() string
 	Init(config interface{}, mgr SidecarManager) error
+	// Start 运行插件直到它退出或 ctx 被取消，返回即视为插件退出。失败时先把错误发送到 errCh 再返回，
+	// 没有发送错误就返回表示插件正常退出。
+	// Start 的 ctx 中带有插件实例名（见 PluginNameFromContext）和带插件名的 logger（见 log.FromContext）
 	Start(ctx context.Context, errCh chan<- error)
 	Stop(ctx context.Context) error
 	Version() string
@@ -20,36 +28,184 @@ type Plugin interface {
 	GetConfigType() interface{}
 }
 
+type pluginNameKey struct{}
+
+// WithPluginName returns a copy of ctx that carries the name of a plugin instance
+func WithPluginName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, pluginNameKey{}, name)
+}
+
+// PluginNameFromContext returns the name of the plugin instance carried by ctx, or "" if there is none
+func PluginNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(pluginNameKey{}).(string)
+	return name
+}
+
+// ConfigReloader 是插件可选实现的接口，插件配置变化时 sidecar 会调用 Reload 而不是重启插件
+type ConfigReloader interface {
+	// Reload applies config, which has the type returned by GetConfigType
+	Reload(config interface{}) error
+}
+
+// GracefulStopper 是插件可选实现的接口，停止插件需要的时间超过 sidecar 默认的超时时间时，
+// sidecar 按 StopTimeout 给 Stop 设置超时
+type GracefulStopper interface {
+	// StopTimeout returns the time Stop needs at most
+	StopTimeout() time.Duration
+}
+
+// ConfigDefaulter 是插件可选实现的接口，sidecar 在 Init 之前、webhook 在准入时调用它为配置设置默认值
+type ConfigDefaulter interface {
+	// DefaultConfig sets the defaults of config, which has the type returned by GetConfigType
+	DefaultConfig(config interface{})
+}
+
+// ConfigValidator 是插件可选实现的接口，sidecar 在 Init 之前、webhook 在准入时调用它校验配置，
+// 因此错误的配置在 kubectl apply 时就会被拒绝
+type ConfigValidator interface {
+	// ValidateConfig checks the defaulted config, which has the type returned by GetConfigType.
+	// The errors carry the path of the invalid field below fldPath.
+	ValidateConfig(config interface{}, fldPath *field.Path) field.ErrorList
+}
+
 // PluginConfig 表示插件的配置
 type PluginConfig struct {
-	Name      string           `json:"name"`
+	Name string `json:"name"` // 插件实例名，在所有插件中唯一
+	// 插件类型，即注册的插件名，同一类型可以配置多个实例。为空时 binary 插件为 binary，其他插件与 Name 相同
+	Type      string           `json:"type,omitempty"`
 	Binary    *v1alpha1.Binary `json:"binary,omitempty"`
 	Config    interface{}      `json:"config"`
 	BootOrder int              `json:"bootOrder"`
+	DependsOn []string         `json:"dependsOn,omitempty"` // 依赖的插件名，依赖的插件就绪后才会启动
+	// 插件的重启策略，为空时使用 SidecarConfig.RestartPolicy
+	RestartPolicy string `json:"restartPolicy,omitempty"`
+}
+
+// BinaryPluginType 是运行二进制文件的插件类型
+const BinaryPluginType = "binary"
+
+// PluginType returns the registered type of the plugin, see PluginConfig.Type
+func (p PluginConfig) PluginType() string {
+	if p.Type != "" {
+		return p.Type
+	}
+	if p.Binary != nil {
+		return BinaryPluginType
+	}
+	return p.Name
 }
 
 // SidecarConfig 表示 Sidecar 的配置
 type SidecarConfig struct {
 	Plugins           []PluginConfig    `json:"plugins"`           // 启动的插件及其配置
-	RestartPolicy     string            `json:"restartPolicy"`     // 重启策略
+	RestartPolicy     string            `json:"restartPolicy"`     // 重启策略，Always、OnFailure 或 Never，默认为 Always
 	Resources         map[string]string `json:"resources"`         // Sidecar 所需的资源
 	SidecarStartOrder string            `json:"sidecarStartOrder"` // Sidecar 的启动顺序，是在主容器之后还是之前
+	// 每一启动阶段等待插件就绪的超时时间（秒）
+	StageTimeoutSeconds int `json:"stageTimeoutSeconds,omitempty"`
+	// sidecar 管理接口的配置
+	AdminServer v1alpha1.AdminServerConfig `json:"adminServer,omitempty"`
+	// sidecar 的 HTTP 监听器，插件和存储通过 SidecarManager.RegisterHandler 注册路由
+	Listeners []v1alpha1.ListenerConfig `json:"listeners,omitempty"`
 }
 
 // PluginStatus 表示插件的状态
 type PluginStatus struct {
-	Name        string   `json:"name"`
-	Version     string   `json:"version"`
-	Running     bool     `json:"running"`
-	LastChecked string   `json:"lastChecked"` // 上一次健康检查时间，格式为 YYYY-MM-DD HH:MM:SS
-	Health      string   `json:"health"`      // 健康状态，例如 "Healthy", "Unhealthy"
-	Infos       []string `json:"infos"`       // 插件的其他信息
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Running bool   `json:"running"`
+	// Conditions 是插件的状态条件，类型为 ConditionReady、ConditionProgressing 和 ConditionDegraded。
+	// 插件每次只需报告当前的条件，lastTransitionTime 由 sidecar 在条件状态变化时维护
+	Conditions   []metav1.Condition `json:"conditions,omitempty"`
+	LastError    string             `json:"lastError,omitempty"`  // 插件最后一次发生的错误
+	ErrorCount   int                `json:"errorCount"`           // 插件累计发生的错误次数
+	RestartCount int                `json:"restartCount"`         // 插件被重启的次数
+	PanicStack   string             `json:"panicStack,omitempty"` // 插件最后一次 panic 时的调用栈
+	Details      map[string]string  `json:"details,omitempty"`    // 插件特有的状态信息
+}
+
+const (
+	// ConditionReady 表示插件正常工作，pod 的就绪状态由它决定
+	ConditionReady = "Ready"
+	// ConditionProgressing 表示插件正在启动、重启或执行耗时的操作
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded 表示插件在工作但发生了错误，或持续失败
+	ConditionDegraded = "Degraded"
+)
+
+// Reasons of the conditions set by the sidecar itself
+const (
+	ReasonPanicked         = "Panicked"
+	ReasonCrashLoopBackOff = "CrashLoopBackOff"
+	ReasonStopped          = "Stopped"
+)
+
+// SetCondition adds or updates the condition of conditionType. LastTransitionTime is only
+// changed when the status of the condition changes.
+func (s *PluginStatus) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// GetCondition returns the condition of conditionType, or nil if it is not set
+func (s *PluginStatus) GetCondition(conditionType string) *metav1.Condition {
+	return meta.FindStatusCondition(s.Conditions, conditionType)
+}
+
+// DeepCopy returns a copy of the status that shares no conditions or details with it
+func (s *PluginStatus) DeepCopy() *PluginStatus {
+	if s == nil {
+		return nil
+	}
+	out := *s
+	if s.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(s.Conditions))
+		for i := range s.Conditions {
+			s.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+	if s.Details != nil {
+		out.Details = make(map[string]string, len(s.Details))
+		for k, v := range s.Details {
+			out.Details[k] = v
+		}
+	}
+	return &out
+}
+
+// IsReady reports whether the plugin is running and its Ready condition is not false.
+// A plugin that reports no Ready condition is ready as long as it is running.
+func (s *PluginStatus) IsReady() bool {
+	if s == nil || !s.Running {
+		return false
+	}
+	ready := s.GetCondition(ConditionReady)
+	return ready == nil || ready.Status == metav1.ConditionTrue
 }
 
+const (
+	// RestartPolicyAlways 插件退出后总是重启
+	RestartPolicyAlways = "Always"
+	// RestartPolicyOnFailure 插件出错退出后重启
+	RestartPolicyOnFailure = "OnFailure"
+	// RestartPolicyNever 插件退出后不再重启
+	RestartPolicyNever = "Never"
+)
+
 // Sidecar 定义Sidecar对外的接口
 type Sidecar interface {
 	InitPlugins() error
 	RemovePlugin(pluginName string) error
+	// EnablePlugin 启动被停用或未启动的插件
+	EnablePlugin(pluginName string) error
+	// DisablePlugin 停止插件，插件在重新启用前不会被启动
+	DisablePlugin(pluginName string) error
+	// RestartPlugin 停止并重新启动插件
+	RestartPlugin(pluginName string) error
 	GetVersion() string
 	PluginStatus(pluginName string) (*PluginStatus, error)
 	Start(ctx context.Context) error
@@ -61,8 +217,75 @@ type Sidecar interface {
 type SidecarManager interface {
 	ctrl.Manager
 	DBManager
+	HTTPServerManager
 	kubernetes.Interface
 }
 
+// StandaloneManager is the SidecarManager of the standalone mode, which runs without a cluster.
+// Its kubernetes.Interface is a fake clientset seeded from a local pod manifest.
+type StandaloneManager interface {
+	SidecarManager
+	// PatchFile 是离线模式下记录对 kubernetes 对象 patch 的本地 JSON 文件
+	PatchFile() string
+}
+
+const (
+	// DefaultListener 是默认的 HTTP 监听器，管理接口和 metrics 默认注册在它上面
+	DefaultListener = "default"
+	// DefaultListenerAddress 是默认 HTTP 监听器的地址
+	DefaultListenerAddress = ":8080"
+	// AdminListener 是管理接口默认使用的监听器，管理接口可以启停插件，默认只监听本机地址
+	AdminListener = "admin"
+	// AdminListenerAddress 是管理接口监听器的默认地址
+	AdminListenerAddress = "127.0.0.1:8081"
+	// HotUpdateListener 是 hot_update 插件默认使用的监听器
+	HotUpdateListener = "hot-update"
+	// HotUpdateListenerAddress 是 hot_update 监听器的默认地址
+	HotUpdateListenerAddress = ":5000"
+)
+
+// HTTPServerManager 管理 sidecar 共享的 HTTP 监听器，插件和存储不应自己监听端口
+type HTTPServerManager interface {
+	// AddListener adds a named listener on address, must be called before StartHTTPServers
+	AddListener(name, address string) error
+	// RegisterHandler registers handler for pattern on the named listener, the pattern
+	// syntax is the one of http.ServeMux. Registering a pattern again replaces its handler.
+	RegisterHandler(listener, pattern string, handler http.Handler) error
+	// UnregisterHandler removes the handler of pattern from the named listener, requests to
+	// the pattern get 404 until it is registered again
+	UnregisterHandler(listener, pattern string) error
+	// StartHTTPServers starts serving on all listeners
+	StartHTTPServers() error
+	// ShutdownHTTPServers gracefully shuts all listeners down
+	ShutdownHTTPServers(ctx context.Context) error
+}
+
+// DBManager 是 sidecar 本地持久化的键值存储，数据保存在注入的状态卷上，kidecar 容器重启后仍然存在
 type DBManager interface {
+	// Bucket returns the store namespaced to name, plugins use their own name
+	Bucket(name string) (KVStore, error)
+	// Dir returns the directory name below the state dir, created if missing, for files that
+	// should survive restarts of the kidecar container
+	Dir(name string) (string, error)
+	// Close closes the store, it is called by the sidecar on exit
+	Close() error
+}
+
+// KVTxn 是键值存储上的读写操作
+type KVTxn interface {
+	// Get returns the value of key, expired values are not found
+	Get(key string) ([]byte, bool, error)
+	// Put stores value under key, it expires after ttl unless ttl is 0
+	Put(key string, value []byte, ttl time.Duration) error
+	// Delete deletes key, deleting a missing key is not an error
+	Delete(key string) error
+}
+
+// KVStore 是一个插件的键值存储命名空间
+type KVStore interface {
+	KVTxn
+	// Keys returns the keys that have not expired
+	Keys() ([]string, error)
+	// Update runs fn in one transaction, either all or none of its writes are applied
+	Update(fn func(tx KVTxn) error) error
 }
@@ -76,8 +76,29 @@ type InjectConfig struct {
 	ServiceAccountName string `json:"serviceAccountName,omitempty"`
 	// ShareProcessNamespace indicates whether to share the process namespace with the pod
 	ShareProcessNamespace *bool `json:"shareProcessNamespace,omitempty"`
+	// ReadinessGate indicates whether to add the kidecar.io/plugins-ready readiness gate to the pod,
+	// the kidecar sets the condition once all of its plugins are ready
+	ReadinessGate bool `json:"readinessGate,omitempty"`
+	// StateVolume is the volume of the kidecar local state store, an emptyDir by default
+	StateVolume StateVolumeConfig `json:"stateVolume,omitempty"`
 }
 
+// StateVolumeConfig describes the volume the kidecar keeps its local state on
+type StateVolumeConfig struct {
+	// ClaimName is the PersistentVolumeClaim to use, so the state survives the pod,
+	// otherwise an emptyDir is used and the state only survives container restarts
+	ClaimName string `json:"claimName,omitempty"`
+}
+
+// PluginsReadyConditionType is the pod condition the kidecar sets from the health of its plugins
+const PluginsReadyConditionType corev1.PodConditionType = "kidecar.io/plugins-ready"
+
+// PluginStatusAnnotation is the pod annotation the kidecar keeps the summary of its plugin statuses in
+const PluginStatusAnnotation = "kidecar.io/plugin-status"
+
+// VersionAnnotation is the pod annotation the kidecar writes its build information to at startup
+const VersionAnnotation = "kidecar.io/version"
+
 // SidecarConfigSpec defines the desired state of SidecarConfig
 type SidecarConfigSpec struct {
 	// Injection contains the configuration settings for the injection process.
@@ -91,16 +112,48 @@ type KidecarConfig struct {
 	RestartPolicy     string            `json:"restartPolicy"`     // 重启策略
 	Resources         map[string]string `json:"resources"`         // Sidecar 所需的资源
 	SidecarStartOrder string            `json:"sidecarStartOrder"` // Sidecar 的启动顺序，是在主容器之后还是之前
+	// 每一启动阶段等待插件就绪的超时时间（秒）
+	StageTimeoutSeconds int `json:"stageTimeoutSeconds,omitempty"`
+	// AdminServer 是 sidecar 管理接口的配置
+	AdminServer AdminServerConfig `json:"adminServer,omitempty"`
+	// Listeners 是 sidecar 的 HTTP 监听器，默认有 default(:8080)、admin(127.0.0.1:8081) 和 hot-update(:5000)，
+	// 配置同名的监听器可以修改它们的地址。监听器只在有路由注册时才监听端口
+	Listeners []ListenerConfig `json:"listeners,omitempty"`
+}
+
+// AdminServerConfig 表示 sidecar 管理接口的配置
+type AdminServerConfig struct {
+	// Enabled 表示是否启动管理接口
+	Enabled bool `json:"enabled,omitempty"`
+	// Listener 是管理接口使用的监听器名称，默认为只监听本机的 admin(127.0.0.1:8081)。
+	// 管理接口没有认证，不要把它注册到对外暴露的监听器上
+	Listener string `json:"listener,omitempty"`
+}
+
+// ListenerConfig 表示一个命名的 HTTP 监听器
+type ListenerConfig struct {
+	// Name 是监听器的名称，插件通过名称注册路由
+	Name string `json:"name"`
+	// Address 是监听地址，例如 :8080
+	Address string `json:"address"`
 }
 
 // PluginConfig 表示插件的配置
 type PluginConfig struct {
 	Name string `json:"name"`
+	// Type 是插件类型，同一类型可以配置多个实例，Name 是实例名
+	// 为空时 binary 插件为 binary，其他插件与 Name 相同
+	Type string `json:"type,omitempty"`
 	// +kubebuilder:pruning:PreserveUnknownFields
 	// +kubebuilder:validation:Schemaless
 	Config    *runtime.RawExtension `json:"config,omitempty"`
 	Binary    *Binary               `json:"binary,omitempty"`
 	BootOrder int                   `json:"bootOrder"`
+	// DependsOn 是依赖的插件名，依赖的插件就绪后才会启动，停止时顺序相反
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// RestartPolicy 是插件的重启策略，为空时使用 KidecarConfig.RestartPolicy
+	// +kubebuilder:validation:Enum=Always;OnFailure;Never
+	RestartPolicy string `json:"restartPolicy,omitempty"`
 }
 
 type Binary struct {
@@ -111,7 +164,7 @@ type Binary struct {
 	// 二进制文件的版本
 	Version string `json:"version"`
 
-	// 二进制文件的校验和（例如 SHA256），用于验证文件完整性
+	// 二进制文件的 SHA-256 校验和，可以带 sha256: 前缀，每次启动前都会校验，为空时不校验
 	Checksum string `json:"checksum"`
 
 	// 二进制文件的启动参数
@@ -123,14 +176,107 @@ type Binary struct {
 	// 二进制文件的依赖项（如果有）
 	Dependencies []string `json:"dependencies,omitempty"`
 
-	// 二进制文件的执行权限（例如 "755"）
+	// 二进制文件的执行权限（例如 "755"），启动前会设置为该权限，无法设置时拒绝启动
 	Permissions string `json:"permissions,omitempty"`
 
 	// 二进制文件的描述信息
 	Description string `json:"description,omitempty"`
 
-	// 下载二进制文件的URL
+	// 下载二进制文件的 URL，Path 不存在或与校验和不一致时下载，校验通过后原子地安装到 Path。
+	// 设置时必须同时设置 Checksum，下载的文件缓存在 kidecar 的状态目录下
 	DownloadURL string `json:"downloadURL,omitempty"`
+
+	// Output 配置二进制进程标准输出和标准错误的处理方式
+	Output *BinaryOutput `json:"output,omitempty"`
+
+	// StopSignal 是停止时发送给进程组的信号（例如 SIGTERM、SIGINT），默认为 SIGTERM
+	StopSignal string `json:"stopSignal,omitempty"`
+
+	// StopGracePeriodSeconds 是发送 StopSignal 后等待进程退出的时间，超时后用 SIGKILL 杀死整个进程组，默认为 10 秒
+	// +kubebuilder:validation:Minimum=0
+	StopGracePeriodSeconds *int `json:"stopGracePeriodSeconds,omitempty"`
+
+	// HealthCheck 配置进程的健康检查，连续失败达到阈值时插件被报告为不健康，并按重启策略重启
+	HealthCheck *BinaryHealthCheck `json:"healthCheck,omitempty"`
+}
+
+// BinaryOutput 配置二进制进程输出的处理方式，每一行输出都会带上插件名写入 kidecar 的日志
+type BinaryOutput struct {
+	// Format 是输出写入 kidecar 日志的格式，prefix 表示每行加上插件名前缀，json 表示写成结构化日志，默认为 prefix
+	// +kubebuilder:validation:Enum=prefix;json
+	Format string `json:"format,omitempty"`
+
+	// Dir 不为空时，输出同时写入该目录下按大小轮转的 <插件名>.log 文件
+	Dir string `json:"dir,omitempty"`
+
+	// MaxSizeMB 是单个输出文件的大小上限（MB），默认为 10
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+
+	// MaxFiles 是保留的轮转文件个数，默认为 3
+	MaxFiles int `json:"maxFiles,omitempty"`
+
+	// TailLines 是插件状态中保留的最后输出行数，默认为 20
+	TailLines int `json:"tailLines,omitempty"`
+}
+
+// BinaryHealthCheck 配置二进制进程的健康检查，Exec、HTTP 和 TCP 必须且只能设置一个。
+// 配置了健康检查时，插件在第一次检查成功后才就绪
+type BinaryHealthCheck struct {
+	// Exec 执行命令检查，命令退出码为 0 时健康
+	Exec *ExecHealthCheck `json:"exec,omitempty"`
+
+	// HTTP 发送 HTTP GET 请求检查，状态码在 200 到 399 之间时健康
+	HTTP *HTTPHealthCheck `json:"http,omitempty"`
+
+	// TCP 检查端口能否建立 TCP 连接
+	TCP *TCPHealthCheck `json:"tcp,omitempty"`
+
+	// InitialDelaySeconds 是进程启动后第一次检查前等待的时间，默认为 0
+	// +kubebuilder:validation:Minimum=0
+	InitialDelaySeconds int `json:"initialDelaySeconds,omitempty"`
+
+	// IntervalSeconds 是两次检查的间隔，默认为 10 秒
+	// +kubebuilder:validation:Minimum=0
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+
+	// TimeoutSeconds 是一次检查的超时时间，默认为 1 秒
+	// +kubebuilder:validation:Minimum=0
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// FailureThreshold 是连续失败多少次后认为进程不健康，默认为 3
+	// +kubebuilder:validation:Minimum=0
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+}
+
+// ExecHealthCheck 执行命令检查进程的健康状态
+type ExecHealthCheck struct {
+	// Command 是要执行的命令及其参数，不经过 shell
+	Command []string `json:"command"`
+}
+
+// HTTPHealthCheck 向进程发送 HTTP GET 请求检查健康状态
+type HTTPHealthCheck struct {
+	// Host 是请求的主机，默认为 localhost
+	Host string `json:"host,omitempty"`
+
+	// Port 是请求的端口
+	Port int `json:"port"`
+
+	// Path 是请求的路径，默认为 /
+	Path string `json:"path,omitempty"`
+
+	// Scheme 是请求的协议，HTTP 或 HTTPS，默认为 HTTP，HTTPS 不校验证书
+	// +kubebuilder:validation:Enum=HTTP;HTTPS
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// TCPHealthCheck 检查进程的端口能否建立连接
+type TCPHealthCheck struct {
+	// Host 是连接的主机，默认为 localhost
+	Host string `json:"host,omitempty"`
+
+	// Port 是连接的端口
+	Port int `json:"port"`
 }
 
 // SidecarConfigStatus defines the observed state of SidecarConfig
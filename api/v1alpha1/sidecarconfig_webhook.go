@@ -17,7 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -27,6 +29,24 @@ import (
 // log is for logging in this package.
 var sidecarconfiglog = logf.Log.WithName("sidecarconfig-resource")
 
+// KidecarConfigHooks 用于在准入时默认和校验 spec.kidecar，插件的实现不在 api 包中，
+// 因此由 webhook 的启动代码通过 RegisterKidecarConfigHooks 注入
+// +kubebuilder:object:generate=false
+type KidecarConfigHooks struct {
+	// Default 为 config 中的插件配置填充默认值
+	Default func(config *KidecarConfig) error
+	// Validate 校验 config，返回的错误路径位于 fldPath 之下
+	Validate func(config *KidecarConfig, fldPath *field.Path) field.ErrorList
+}
+
+var kidecarConfigHooks KidecarConfigHooks
+
+// RegisterKidecarConfigHooks registers the hooks the SidecarConfig webhooks call on admission,
+// it must be called before the webhooks are set up
+func RegisterKidecarConfigHooks(hooks KidecarConfigHooks) {
+	kidecarConfigHooks = hooks
+}
+
 // SetupWebhookWithManager will setup the manager to manage the webhooks
 func (r *SidecarConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
@@ -44,7 +64,13 @@ var _ webhook.Defaulter = &SidecarConfig{}
 func (r *SidecarConfig) Default() {
 	sidecarconfiglog.Info("default", "name", r.Name)
 
-	// TODO(user): fill in your defaulting logic.
+	if kidecarConfigHooks.Default == nil {
+		return
+	}
+	if err := kidecarConfigHooks.Default(&r.Spec.Kidecar); err != nil {
+		// 默认值填充失败时不拒绝请求，由校验 webhook 报告具体的错误
+		sidecarconfiglog.Error(err, "failed to default kidecar config", "name", r.Name)
+	}
 }
 
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
@@ -58,16 +84,14 @@ var _ webhook.Validator = &SidecarConfig{}
 func (r *SidecarConfig) ValidateCreate() (admission.Warnings, error) {
 	sidecarconfiglog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil, nil
+	return nil, r.validate()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *SidecarConfig) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
 	sidecarconfiglog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil, nil
+	return nil, r.validate()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -77,3 +101,14 @@ func (r *SidecarConfig) ValidateDelete() (admission.Warnings, error) {
 	// TODO(user): fill in your validation logic upon object deletion.
 	return nil, nil
 }
+
+func (r *SidecarConfig) validate() error {
+	if kidecarConfigHooks.Validate == nil {
+		return nil
+	}
+	errs := kidecarConfigHooks.Validate(&r.Spec.Kidecar, field.NewPath("spec", "kidecar"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("SidecarConfig").GroupKind(), r.Name, errs)
+}
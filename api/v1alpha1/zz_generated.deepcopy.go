@@ -26,6 +26,21 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdminServerConfig) DeepCopyInto(out *AdminServerConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdminServerConfig.
+func (in *AdminServerConfig) DeepCopy() *AdminServerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AdminServerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Binary) DeepCopyInto(out *Binary) {
 	*out = *in
@@ -44,6 +59,21 @@ func (in *Binary) DeepCopyInto(out *Binary) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Output != nil {
+		in, out := &in.Output, &out.Output
+		*out = new(BinaryOutput)
+		**out = **in
+	}
+	if in.StopGracePeriodSeconds != nil {
+		in, out := &in.StopGracePeriodSeconds, &out.StopGracePeriodSeconds
+		*out = new(int)
+		**out = **in
+	}
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(BinaryHealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Binary.
@@ -56,6 +86,86 @@ func (in *Binary) DeepCopy() *Binary {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BinaryHealthCheck) DeepCopyInto(out *BinaryHealthCheck) {
+	*out = *in
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(ExecHealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPHealthCheck)
+		**out = **in
+	}
+	if in.TCP != nil {
+		in, out := &in.TCP, &out.TCP
+		*out = new(TCPHealthCheck)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BinaryHealthCheck.
+func (in *BinaryHealthCheck) DeepCopy() *BinaryHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(BinaryHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BinaryOutput) DeepCopyInto(out *BinaryOutput) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BinaryOutput.
+func (in *BinaryOutput) DeepCopy() *BinaryOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(BinaryOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecHealthCheck) DeepCopyInto(out *ExecHealthCheck) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecHealthCheck.
+func (in *ExecHealthCheck) DeepCopy() *ExecHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPHealthCheck) DeepCopyInto(out *HTTPHealthCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPHealthCheck.
+func (in *HTTPHealthCheck) DeepCopy() *HTTPHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InjectConfig) DeepCopyInto(out *InjectConfig) {
 	*out = *in
@@ -107,6 +217,7 @@ func (in *InjectConfig) DeepCopyInto(out *InjectConfig) {
 		*out = new(bool)
 		**out = **in
 	}
+	out.StateVolume = in.StateVolume
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InjectConfig.
@@ -136,6 +247,12 @@ func (in *KidecarConfig) DeepCopyInto(out *KidecarConfig) {
 			(*out)[key] = val
 		}
 	}
+	out.AdminServer = in.AdminServer
+	if in.Listeners != nil {
+		in, out := &in.Listeners, &out.Listeners
+		*out = make([]ListenerConfig, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KidecarConfig.
@@ -148,6 +265,21 @@ func (in *KidecarConfig) DeepCopy() *KidecarConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ListenerConfig) DeepCopyInto(out *ListenerConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ListenerConfig.
+func (in *ListenerConfig) DeepCopy() *ListenerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ListenerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PluginConfig) DeepCopyInto(out *PluginConfig) {
 	*out = *in
@@ -161,6 +293,11 @@ func (in *PluginConfig) DeepCopyInto(out *PluginConfig) {
 		*out = new(Binary)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginConfig.
@@ -263,3 +400,33 @@ func (in *SidecarConfigStatus) DeepCopy() *SidecarConfigStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StateVolumeConfig) DeepCopyInto(out *StateVolumeConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StateVolumeConfig.
+func (in *StateVolumeConfig) DeepCopy() *StateVolumeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(StateVolumeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TCPHealthCheck) DeepCopyInto(out *TCPHealthCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TCPHealthCheck.
+func (in *TCPHealthCheck) DeepCopy() *TCPHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(TCPHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
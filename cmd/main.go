@@ -37,6 +37,7 @@ import (
 
 	serverlessv1alpha1 "github.com/magicsong/kidecar/api/v1alpha1"
 	"github.com/magicsong/kidecar/internal/controller"
+	"github.com/magicsong/kidecar/pkg/assembler"
 	"github.com/magicsong/kidecar/pkg/collector"
 	mywebhook "github.com/magicsong/kidecar/pkg/webhook"
 	// +kubebuilder:scaffold:imports
@@ -154,6 +155,8 @@ func main() {
 		os.Exit(1)
 	}
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		// 插件配置的默认值和校验与 sidecar 加载配置时保持一致
+		serverlessv1alpha1.RegisterKidecarConfigHooks(assembler.KidecarConfigHooks())
 		if err = (&serverlessv1alpha1.SidecarConfig{}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "SidecarConfig")
 			os.Exit(1)
@@ -1,44 +1,84 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"os"
 
 	"github.com/magicsong/kidecar/pkg/assembler"
 	"github.com/magicsong/kidecar/pkg/info"
 	"github.com/magicsong/kidecar/pkg/manager"
+	"github.com/magicsong/kidecar/pkg/reaper"
+	"github.com/magicsong/kidecar/pkg/version"
 	flag "github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
-var configPath string
+var (
+	configPath  string
+	stateDir    string
+	standalone  bool
+	podManifest string
+	patchFile   string
+	showVersion bool
+)
 
 func init() {
 	flag.StringVar(&configPath, "config", "/opt/kidecar/config.yaml", "config file path")
+	flag.StringVar(&stateDir, "state-dir", "/var/lib/kidecar", "directory of the local state store, empty to disable it")
+	flag.BoolVar(&standalone, "standalone", false, "run without a kubernetes cluster, on a fake clientset seeded from --pod-manifest")
+	flag.StringVar(&podManifest, "pod-manifest", "pod.yaml", "manifest of the current pod in standalone mode")
+	flag.BoolVar(&showVersion, "version", false, "print the version and exit")
+	flag.StringVar(&patchFile, "patch-file", manager.DefaultPatchFile, "local JSON file the patches of InKube storage are written to in standalone mode")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout))
+	}
 	logf.SetLogger(zap.New())
 	log := logf.Log.WithName("manager-examples")
 	flag.Parse()
+	if showVersion {
+		fmt.Println(version.Get())
+		return
+	}
+	if standalone && !flag.CommandLine.Changed("state-dir") {
+		// 离线模式通常运行在开发机上，状态保存在当前目录
+		stateDir = "kidecar-state"
+	}
+	log.Info("starting kidecar", "version", version.Version, "gitCommit", version.GitCommit, "buildDate", version.BuildDate)
 	sidecar := assembler.NewSidecar()
 	if err := sidecar.LoadConfig(configPath); err != nil {
 		log.Error(err, "failed to load config")
 		os.Exit(1)
 	}
-	mgr, err := manager.NewManager()
+	mgr, err := manager.NewManager(manager.Options{
+		StateDir:    stateDir,
+		Standalone:  standalone,
+		PodManifest: podManifest,
+		PatchFile:   patchFile,
+	})
 	if err != nil {
 		log.Error(err, "failed to create manager")
 		panic(err)
 	}
+	defer func() {
+		if err := mgr.Close(); err != nil {
+			log.Error(err, "failed to close state store")
+		}
+	}()
 	info.SetGlobalKubeInterface(mgr)
 	sidecar.SetupWithManager(mgr)
 	// add plugins
 	if err := sidecar.InitPlugins(); err != nil {
 		panic(err)
 	}
-	ctx := context.TODO()
+	// ctx is cancelled on SIGTERM/SIGINT, after which the sidecar stops all plugins in order
+	ctx := ctrl.SetupSignalHandler()
+	// kidecar 作为容器的 init 进程时，负责回收插件遗留的僵尸进程
+	reaper.Start(ctx, logf.Log.WithName("reaper"))
 	if err := sidecar.Start(ctx); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/assembler"
+	"github.com/magicsong/kidecar/pkg/injector"
+	flag "github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const validateUsage = `Usage: kidecar validate FILE...
+
+Validate kidecar config files offline. A file is either a kidecar config as mounted into the
+sidecar, or SidecarConfig manifests whose spec.kidecar is validated. Every error is printed with
+the path of the invalid field, and the exit code is 1 if any file is invalid.
+`
+
+// runValidate implements the validate subcommand and returns the exit code
+func runValidate(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprint(out, validateUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	code := 0
+	for _, path := range flags.Args() {
+		errs, err := validateFile(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if len(errs) == 0 {
+			fmt.Fprintf(out, "%s: ok\n", path)
+			continue
+		}
+		code = 1
+		for _, err := range errs {
+			fmt.Fprintf(out, "%s: %v\n", path, err)
+		}
+	}
+	return code
+}
+
+// validateFile validates every YAML document of the file at path
+func validateFile(path string) ([]error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	var errs []error
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return errs, nil
+		}
+		if err != nil {
+			return errs, fmt.Errorf("failed to read YAML: %w", err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		errs = append(errs, validateDocument(doc)...)
+	}
+}
+
+// validateDocument validates a SidecarConfig manifest or a kidecar config
+func validateDocument(doc []byte) []error {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+		return []error{fmt.Errorf("invalid YAML: %w", err)}
+	}
+	if typeMeta.Kind != "SidecarConfig" {
+		config := &api.SidecarConfig{}
+		if err := yaml.UnmarshalStrict(doc, config); err != nil {
+			return []error{fmt.Errorf("failed to decode kidecar config: %w", err)}
+		}
+		return toErrors(assembler.ValidateConfig(config, nil), "")
+	}
+
+	manifest := &v1alpha1.SidecarConfig{}
+	if err := yaml.UnmarshalStrict(doc, manifest); err != nil {
+		return []error{fmt.Errorf("failed to decode SidecarConfig: %w", err)}
+	}
+	prefix := fmt.Sprintf("SidecarConfig %s: ", manifest.Name)
+	config, err := injector.ConvertKubeConfigToSidecarConfig(&manifest.Spec.Kidecar)
+	if err != nil {
+		return []error{fmt.Errorf("%s%w", prefix, err)}
+	}
+	return toErrors(assembler.ValidateConfig(config, field.NewPath("spec", "kidecar")), prefix)
+}
+
+func toErrors(errs field.ErrorList, prefix string) []error {
+	result := make([]error, 0, len(errs))
+	for _, err := range errs {
+		result = append(result, fmt.Errorf("%s%w", prefix, err))
+	}
+	return result
+}
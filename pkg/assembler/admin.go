@@ -0,0 +1,247 @@
+package assembler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/version"
+)
+
+// redactedValue 替换配置中的敏感信息
+const redactedValue = "******"
+
+// sensitiveKeys are the config keys whose values are hidden by the admin API
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "apikey", "api_key", "credential", "cookie"}
+
+// pluginInfo is the admin API view of a plugin
+type pluginInfo struct {
+	Name        string            `json:"name"`
+	Enabled     bool              `json:"enabled"`
+	Status      *api.PluginStatus `json:"status,omitempty"`
+	StatusError string            `json:"statusError,omitempty"`
+	// Config is the effective config of the plugin with secrets redacted
+	Config interface{} `json:"config,omitempty"`
+}
+
+// sidecarInfo is the admin API view of the sidecar itself
+type sidecarInfo struct {
+	Version         string `json:"version"`
+	ConfigPath      string `json:"configPath"`
+	ConfigHash      string `json:"configHash"`
+	LastReloadError string `json:"lastReloadError,omitempty"`
+}
+
+// registerAdminHandlers registers the admin API on its listener. The API is not
+// authenticated, so its default listener only binds the loopback address.
+func (s *sidecar) registerAdminHandlers() error {
+	listener := s.SidecarConfig.AdminServer.Listener
+	if listener == "" {
+		listener = api.AdminListener
+	}
+	handler := s.adminHandler()
+	for _, pattern := range []string{"/healthz", "/version", "/api/v1/"} {
+		if err := s.SidecarManager.RegisterHandler(listener, pattern, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sidecar) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, version.Get())
+	})
+	mux.HandleFunc("GET /api/v1/info", s.handleInfo)
+	mux.HandleFunc("GET /api/v1/plugins", s.handleListPlugins)
+	mux.HandleFunc("GET /api/v1/plugins/{name}", s.handleGetPlugin)
+	mux.HandleFunc("POST /api/v1/plugins/{name}/enable", s.handlePluginAction(s.EnablePlugin))
+	mux.HandleFunc("POST /api/v1/plugins/{name}/disable", s.handlePluginAction(s.DisablePlugin))
+	mux.HandleFunc("POST /api/v1/plugins/{name}/restart", s.handlePluginAction(s.RestartPlugin))
+	return mux
+}
+
+func (s *sidecar) handleInfo(w http.ResponseWriter, r *http.Request) {
+	s.lock.RLock()
+	info := sidecarInfo{
+		Version:    s.GetVersion(),
+		ConfigPath: s.configPath,
+		ConfigHash: s.configHash,
+	}
+	if s.lastReloadError != nil {
+		info.LastReloadError = s.lastReloadError.Error()
+	}
+	s.lock.RUnlock()
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *sidecar) handleListPlugins(w http.ResponseWriter, r *http.Request) {
+	names := make(map[string]bool)
+	for _, name := range s.pluginNames() {
+		names[name] = true
+	}
+	for _, p := range s.sidecarConfig().Plugins {
+		names[p.Name] = true
+	}
+	result := make([]pluginInfo, 0, len(names))
+	for name := range names {
+		result = append(result, s.pluginInfo(name, false))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *sidecar) handleGetPlugin(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.pluginExists(name) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("plugin %s not found", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.pluginInfo(name, true))
+}
+
+func (s *sidecar) handlePluginAction(action func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !s.pluginExists(name) {
+			writeError(w, http.StatusNotFound, fmt.Errorf("plugin %s not found", name))
+			return
+		}
+		if err := action(name); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.pluginInfo(name, false))
+	}
+}
+
+func (s *sidecar) pluginExists(name string) bool {
+	s.lock.RLock()
+	_, ok := s.plugins[name]
+	s.lock.RUnlock()
+	if ok {
+		return true
+	}
+	_, ok = s.lookupPluginConfig(name)
+	return ok
+}
+
+func (s *sidecar) pluginInfo(name string, withConfig bool) pluginInfo {
+	s.lock.RLock()
+	_, initialized := s.plugins[name]
+	info := pluginInfo{
+		Name:    name,
+		Enabled: initialized && !s.disabled[name],
+	}
+	s.lock.RUnlock()
+	if initialized {
+		status, err := s.updatePluginStatus(name)
+		if err != nil {
+			info.StatusError = err.Error()
+		}
+		info.Status = status
+	}
+	if withConfig {
+		if p, ok := s.lookupPluginConfig(name); ok {
+			config, err := effectiveConfig(p)
+			if err != nil {
+				info.StatusError = err.Error()
+			}
+			info.Config = config
+		}
+	}
+	return info
+}
+
+func (s *sidecar) sidecarConfig() *api.SidecarConfig {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.SidecarConfig
+}
+
+// lookupPluginConfig is getPluginFromConfig for callers not holding any lock
+func (s *sidecar) lookupPluginConfig(name string) (api.PluginConfig, bool) {
+	for _, p := range s.sidecarConfig().Plugins {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return api.PluginConfig{}, false
+}
+
+// effectiveConfig decodes the config into the plugin's config type, so that it shows every
+// field the plugin sees, and redacts sensitive values
+func effectiveConfig(p api.PluginConfig) (interface{}, error) {
+	_, config, err := decodePluginConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config of plugin %s: %w", p.Name, err)
+	}
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config of plugin %s: %w", p.Name, err)
+	}
+	return redact(result), nil
+}
+
+// redact replaces the values of sensitive keys, including KEY=VALUE environment entries
+func redact(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if isSensitiveKey(key) {
+				value[key] = redactedValue
+				continue
+			}
+			value[key] = redact(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redact(item)
+		}
+		return value
+	case string:
+		if key, _, ok := strings.Cut(value, "="); ok && isSensitiveKey(key) {
+			return key + "=" + redactedValue
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
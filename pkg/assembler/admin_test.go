@@ -0,0 +1,41 @@
+package assembler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+		want  interface{}
+	}{
+		{
+			name:  "sensitive keys are redacted",
+			input: map[string]interface{}{"url": "http://localhost", "Authorization": "Bearer abc", "dbPassword": "123"},
+			want:  map[string]interface{}{"url": "http://localhost", "Authorization": redactedValue, "dbPassword": redactedValue},
+		},
+		{
+			name: "nested values are redacted",
+			input: map[string]interface{}{"endpoints": []interface{}{
+				map[string]interface{}{"headers": map[string]interface{}{"X-Api-Token": "abc", "Accept": "*/*"}},
+			}},
+			want: map[string]interface{}{"endpoints": []interface{}{
+				map[string]interface{}{"headers": map[string]interface{}{"X-Api-Token": redactedValue, "Accept": "*/*"}},
+			}},
+		},
+		{
+			name:  "sensitive env entries are redacted",
+			input: map[string]interface{}{"env": []interface{}{"ENV_VAR=value", "SECRET_KEY=abc"}},
+			want:  map[string]interface{}{"env": []interface{}{"ENV_VAR=value", "SECRET_KEY=" + redactedValue}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/kidecar/api"
+)
+
+// buildBootStages groups the enabled plugins into boot stages.
+//
+// Plugins are first grouped by ascending BootOrder. A plugin listed in DependsOn always
+// lands in an earlier stage than the plugins depending on it, even if its BootOrder is
+// larger, so explicit dependencies take precedence over BootOrder. Unknown or disabled
+// dependencies and dependency cycles are rejected.
+func buildBootStages(configs []api.PluginConfig) ([][]string, error) {
+	nodes := make(map[string]api.PluginConfig)
+	disabled := make(map[string]bool)
+	orders := make(map[int]bool)
+	for _, c := range configs {
+		if _, ok := nodes[c.Name]; ok || disabled[c.Name] {
+			return nil, fmt.Errorf("duplicate plugin %s", c.Name)
+		}
+		if c.BootOrder <= 0 {
+			disabled[c.Name] = true
+			continue
+		}
+		nodes[c.Name] = c
+		orders[c.BootOrder] = true
+	}
+
+	// base stage of each BootOrder
+	sortedOrders := make([]int, 0, len(orders))
+	for order := range orders {
+		sortedOrders = append(sortedOrders, order)
+	}
+	sort.Ints(sortedOrders)
+	baseStage := make(map[int]int, len(sortedOrders))
+	for i, order := range sortedOrders {
+		baseStage[order] = i
+	}
+
+	for name, c := range nodes {
+		for _, dep := range c.DependsOn {
+			if dep == name {
+				return nil, fmt.Errorf("plugin %s depends on itself", name)
+			}
+			if disabled[dep] {
+				return nil, fmt.Errorf("plugin %s depends on disabled plugin %s", name, dep)
+			}
+			if _, ok := nodes[dep]; !ok {
+				return nil, fmt.Errorf("plugin %s depends on unknown plugin %s", name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(nodes))
+	stageOf := make(map[string]int, len(nodes))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(append([]string{}, path[indexOf(path, name):]...), name)
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+		state[name] = visiting
+		path = append(path, name)
+		stage := baseStage[nodes[name].BootOrder]
+		for _, dep := range nodes[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+			if stageOf[dep]+1 > stage {
+				stage = stageOf[dep] + 1
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		stageOf[name] = stage
+		return nil
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	maxStage := -1
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+		if stageOf[name] > maxStage {
+			maxStage = stageOf[name]
+		}
+	}
+
+	stages := make([][]string, maxStage+1)
+	for _, name := range names {
+		stages[stageOf[name]] = append(stages[stageOf[name]], name)
+	}
+	// drop stages left empty by dependencies
+	result := make([][]string, 0, len(stages))
+	for _, stage := range stages {
+		if len(stage) > 0 {
+			result = append(result, stage)
+		}
+	}
+	return result, nil
+}
+
+// reverseStages returns plugin names in the order they should be stopped
+func reverseStages(stages [][]string) []string {
+	var names []string
+	for i := len(stages) - 1; i >= 0; i-- {
+		for j := len(stages[i]) - 1; j >= 0; j-- {
+			names = append(names, stages[i][j])
+		}
+	}
+	return names
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
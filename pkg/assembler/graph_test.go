@@ -0,0 +1,113 @@
+package assembler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/magicsong/kidecar/api"
+)
+
+func TestBuildBootStages(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []api.PluginConfig
+		want    [][]string
+		wantErr string
+	}{
+		{
+			name: "group by boot order",
+			configs: []api.PluginConfig{
+				{Name: "c", BootOrder: 2},
+				{Name: "a", BootOrder: 1},
+				{Name: "b", BootOrder: 1},
+			},
+			want: [][]string{{"a", "b"}, {"c"}},
+		},
+		{
+			name: "disabled plugins are skipped",
+			configs: []api.PluginConfig{
+				{Name: "a", BootOrder: 1},
+				{Name: "b", BootOrder: 0},
+				{Name: "c", BootOrder: -1},
+			},
+			want: [][]string{{"a"}},
+		},
+		{
+			name: "dependency overrides boot order",
+			configs: []api.PluginConfig{
+				{Name: "http_probe", BootOrder: 1, DependsOn: []string{"kubectl-proxy"}},
+				{Name: "kubectl-proxy", BootOrder: 1},
+				{Name: "hot_update", BootOrder: 1},
+			},
+			want: [][]string{{"hot_update", "kubectl-proxy"}, {"http_probe"}},
+		},
+		{
+			name: "chained dependencies",
+			configs: []api.PluginConfig{
+				{Name: "a", BootOrder: 1, DependsOn: []string{"b"}},
+				{Name: "b", BootOrder: 2, DependsOn: []string{"c"}},
+				{Name: "c", BootOrder: 3},
+			},
+			want: [][]string{{"c"}, {"b"}, {"a"}},
+		},
+		{
+			name: "cycle",
+			configs: []api.PluginConfig{
+				{Name: "a", BootOrder: 1, DependsOn: []string{"b"}},
+				{Name: "b", BootOrder: 1, DependsOn: []string{"a"}},
+			},
+			wantErr: "dependency cycle detected: a -> b -> a",
+		},
+		{
+			name: "self dependency",
+			configs: []api.PluginConfig{
+				{Name: "a", BootOrder: 1, DependsOn: []string{"a"}},
+			},
+			wantErr: "depends on itself",
+		},
+		{
+			name: "unknown dependency",
+			configs: []api.PluginConfig{
+				{Name: "a", BootOrder: 1, DependsOn: []string{"b"}},
+			},
+			wantErr: "unknown plugin b",
+		},
+		{
+			name: "disabled dependency",
+			configs: []api.PluginConfig{
+				{Name: "a", BootOrder: 1, DependsOn: []string{"b"}},
+				{Name: "b", BootOrder: 0},
+			},
+			wantErr: "disabled plugin b",
+		},
+		{
+			name: "duplicate plugin",
+			configs: []api.PluginConfig{
+				{Name: "a", BootOrder: 1},
+				{Name: "a", BootOrder: 2},
+			},
+			wantErr: "duplicate plugin a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildBootStages(tt.configs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("buildBootStages() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildBootStages() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildBootStages() = %v, want %v", got, tt.want)
+			}
+			if stop := reverseStages(got); len(stop) > 0 && stop[len(stop)-1] != got[0][0] {
+				t.Errorf("reverseStages() = %v, want %s stopped last", stop, got[0][0])
+			}
+		})
+	}
+}
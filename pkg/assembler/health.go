@@ -0,0 +1,77 @@
+package assembler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+)
+
+// livenessTimeout 状态轮询超过该时间没有进展时，认为 sidecar 已经卡住
+const livenessTimeout = 3 * pluginStatusPollInterval
+
+// registerHealthHandlers registers /livez and /readyz on the default listener, they are
+// used as the probes of the kidecar container
+func (s *sidecar) registerHealthHandlers() error {
+	if err := s.SidecarManager.RegisterHandler(api.DefaultListener, "/livez", http.HandlerFunc(s.handleLivez)); err != nil {
+		return err
+	}
+	return s.SidecarManager.RegisterHandler(api.DefaultListener, "/readyz", http.HandlerFunc(s.handleReadyz))
+}
+
+// heartbeat records that the status poll loop is making progress
+func (s *sidecar) heartbeat() {
+	s.lastHeartbeat.Store(time.Now().UnixNano())
+}
+
+func (s *sidecar) handleLivez(w http.ResponseWriter, r *http.Request) {
+	last := time.Unix(0, s.lastHeartbeat.Load())
+	if since := time.Since(last); since > livenessTimeout {
+		writeHealth(w, []string{fmt.Sprintf("plugin status loop made no progress for %s", since.Round(time.Second))})
+		return
+	}
+	writeHealth(w, nil)
+}
+
+func (s *sidecar) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, s.notReadyPlugins())
+}
+
+// notReadyPlugins returns the reasons why enabled plugins are not ready. A plugin is
+// ready when it is running and healthy.
+func (s *sidecar) notReadyPlugins() []string {
+	var reasons []string
+	for _, name := range s.pluginNames() {
+		if s.isDisabled(name) {
+			continue
+		}
+		status, err := s.updatePluginStatus(name)
+		switch {
+		case err != nil:
+			reasons = append(reasons, fmt.Sprintf("plugin %s: %v", name, err))
+		case !status.Running:
+			reasons = append(reasons, fmt.Sprintf("plugin %s: not running", name))
+		case !isPluginHealthy(status):
+			ready := status.GetCondition(api.ConditionReady)
+			reasons = append(reasons, fmt.Sprintf("plugin %s: %s: %s", name, ready.Reason, ready.Message))
+		}
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// writeHealth writes the result of a health check in the plain text format of the
+// kubernetes health endpoints
+func writeHealth(w http.ResponseWriter, failures []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(failures) == 0 {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "ok")
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, "[-]%s\nhealth check failed", strings.Join(failures, "\n[-]"))
+}
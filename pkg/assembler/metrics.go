@@ -0,0 +1,55 @@
+package assembler
+
+import (
+	"github.com/magicsong/kidecar/api"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	pluginRunningDesc = prometheus.NewDesc("kidecar_plugin_running",
+		"Whether the plugin is running.", []string{"plugin"}, nil)
+	pluginConditionDesc = prometheus.NewDesc("kidecar_plugin_condition",
+		"Whether the condition of the plugin is true.", []string{"plugin", "condition", "reason"}, nil)
+	pluginRestartsDesc = prometheus.NewDesc("kidecar_plugin_restarts_total",
+		"Number of times the plugin has been restarted.", []string{"plugin"}, nil)
+	pluginErrorsDesc = prometheus.NewDesc("kidecar_plugin_errors_total",
+		"Number of errors of the plugin.", []string{"plugin"}, nil)
+)
+
+// statusCollector exports the last polled plugin statuses as prometheus metrics
+type statusCollector struct {
+	s *sidecar
+}
+
+func (c *statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pluginRunningDesc
+	ch <- pluginConditionDesc
+	ch <- pluginRestartsDesc
+	ch <- pluginErrorsDesc
+}
+
+func (c *statusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.lock.RLock()
+	statuses := make(map[string]*api.PluginStatus, len(c.s.pluginStatuses))
+	for name, status := range c.s.pluginStatuses {
+		statuses[name] = status.DeepCopy()
+	}
+	c.s.lock.RUnlock()
+	for name, status := range statuses {
+		ch <- prometheus.MustNewConstMetric(pluginRunningDesc, prometheus.GaugeValue, boolToFloat(status.Running), name)
+		for _, condition := range status.Conditions {
+			ch <- prometheus.MustNewConstMetric(pluginConditionDesc, prometheus.GaugeValue,
+				boolToFloat(condition.Status == metav1.ConditionTrue), name, condition.Type, condition.Reason)
+		}
+		ch <- prometheus.MustNewConstMetric(pluginRestartsDesc, prometheus.CounterValue, float64(status.RestartCount), name)
+		ch <- prometheus.MustNewConstMetric(pluginErrorsDesc, prometheus.CounterValue, float64(status.ErrorCount), name)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -2,30 +2,62 @@ package assembler
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
 	"github.com/magicsong/kidecar/pkg/plugins"
-	"github.com/magicsong/kidecar/pkg/plugins/binary"
+	"github.com/magicsong/kidecar/pkg/store"
 	"github.com/magicsong/kidecar/pkg/utils"
-	"gopkg.in/yaml.v3"
+	"github.com/magicsong/kidecar/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
 )
 
 var _ api.Sidecar = &sidecar{}
 
+const (
+	// defaultStopTimeout 是停止整个 sidecar 的最短超时时间，插件的停止超时之和更长时以后者为准
+	defaultStopTimeout = 20 * time.Second
+	// pluginStopTimeout 是停止单个插件的默认超时时间，见 api.GracefulStopper
+	pluginStopTimeout = 5 * time.Second
+	// defaultStageTimeout 是每一启动阶段等待插件就绪的默认超时时间
+	defaultStageTimeout = 2 * time.Minute
+	// stagePollInterval 是启动阶段检查插件状态的间隔
+	stagePollInterval = time.Second
+	// pluginStatusPollInterval 是定期刷新插件状态的间隔
+	pluginStatusPollInterval = 30 * time.Second
+)
+
 type sidecar struct {
 	plugins          map[string]api.Plugin
 	lock             sync.RWMutex
 	isStartWebServer bool
 	version          string
 	pluginStatuses   map[string]*api.PluginStatus
+	supervisors      map[string]*supervisor
+	// stages 是按 BootOrder 和 DependsOn 计算出的启动阶段
+	stages [][]string
+	// configPath 和 configHash 是当前加载的配置文件及其哈希，用于热加载
+	configPath string
+	configHash string
+	// reloadLock 保证热加载和停止不会同时进行
+	reloadLock      sync.Mutex
+	lastReloadError error
+	// pluginCtx 是插件运行使用的 context，在 Start 中创建，用于运行时启用插件
+	pluginCtx context.Context
+	// disabled 记录通过管理接口停用的插件，停用的插件不会被启动
+	disabled map[string]bool
+	// lastHeartbeat 是状态轮询最后一次执行的时间（UnixNano），用于 /livez
+	lastHeartbeat atomic.Int64
 	*api.SidecarConfig
 	api.SidecarManager
 	log logr.Logger
@@ -33,73 +65,170 @@ type sidecar struct {
 
 // LoadConfig implements api.Sidecar.
 func (s *sidecar) LoadConfig(path string) error {
-	config, err := loadConfig(path)
+	config, stages, hash, err := parseConfig(path)
 	if err != nil {
 		return fmt.Errorf("failed to load config from path %s, err: %w", path, err)
 	}
 	s.SidecarConfig = config
+	s.stages = stages
+	s.configPath = path
+	s.configHash = hash
+	s.isStartWebServer = config.AdminServer.Enabled
 	return nil
 }
 
-func loadConfig(configPath string) (*api.SidecarConfig, error) {
+// parseConfig loads and validates the config file, returning the boot stages and the hash of the file
+func parseConfig(configPath string) (*api.SidecarConfig, [][]string, string, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, nil, "", fmt.Errorf("failed to read config file: %w", err)
 	}
 	sidecarConfig := &api.SidecarConfig{}
 	if err := yaml.Unmarshal(data, &sidecarConfig); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal sidecarConfig file: %w", err)
+		return nil, nil, "", fmt.Errorf("failed to unmarshal sidecarConfig file: %w", err)
+	}
+	stages, err := buildBootStages(sidecarConfig.Plugins)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid plugin dependencies: %w", err)
+	}
+	if err := validateRestartPolicies(sidecarConfig); err != nil {
+		return nil, nil, "", fmt.Errorf("invalid restart policy: %w", err)
 	}
-	return sidecarConfig, nil
+	return sidecarConfig, stages, utils.Hash(string(data)), nil
 }
 
 // SetupWithManager implements api.Sidecar.
 func (s *sidecar) SetupWithManager(mgr api.SidecarManager) error {
 	s.SidecarManager = mgr
+	// 监听器需要在插件初始化之前添加，插件在 Init 中注册路由
+	for _, l := range listeners(s.SidecarConfig) {
+		if err := mgr.AddListener(l.Name, l.Address); err != nil {
+			return fmt.Errorf("failed to add listener %s: %w", l.Name, err)
+		}
+	}
 	return nil
 }
 
+// listeners returns the configured listeners on top of the default ones, a configured
+// listener with the name of a default one changes its address. A listener is only bound
+// once a handler is registered on it. Listener changes take effect only after the sidecar
+// is restarted.
+func listeners(config *api.SidecarConfig) []v1alpha1.ListenerConfig {
+	result := []v1alpha1.ListenerConfig{
+		{Name: api.DefaultListener, Address: api.DefaultListenerAddress},
+		{Name: api.AdminListener, Address: api.AdminListenerAddress},
+		{Name: api.HotUpdateListener, Address: api.HotUpdateListenerAddress},
+	}
+	return append(result, config.Listeners...)
+}
+
 func NewSidecar() api.Sidecar {
 	return &sidecar{
 		plugins:        make(map[string]api.Plugin),
 		pluginStatuses: make(map[string]*api.PluginStatus),
+		supervisors:    make(map[string]*supervisor),
+		disabled:       make(map[string]bool),
 		log:            logf.Log.WithName("sidecar"),
+		version:        version.Version,
 	}
 }
 
 func (s *sidecar) InitPlugins() error {
 	for _, p := range s.SidecarConfig.Plugins {
-		if p.Binary != nil {
-			s.log.Info("binary plugin found", "plugin", p.Name)
-			s.plugins[p.Name] = binary.NewPlugin(*p.Binary)
-		} else {
-			if err := s.AddPlugin(p.Name, p.Config); err != nil {
-				return fmt.Errorf("failed to add built in plugin %s,err:%w", p.Name, err)
-			}
+		if !s.isPluginEnabled(p.Name) {
+			s.log.Info("plugin is disabled, skip it", "plugin", p.Name, "bootOrder", p.BootOrder)
+			continue
+		}
+		if err := s.initPlugin(p); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// AddPlugin implements api.Sidecar.
-func (s *sidecar) AddPlugin(name string, config interface{}) error {
-	//lock and add
+// initPlugin creates a new instance of the plugin described by p, initializes it and adds it
+func (s *sidecar) initPlugin(p api.PluginConfig) error {
+	plugin, err := s.newPlugin(p)
+	if err != nil {
+		return err
+	}
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	plugin, ok := plugins.PluginRegistry[name]
-	if !ok {
-		return fmt.Errorf("failed to find plugin %s", name)
+	s.plugins[p.Name] = plugin
+	return nil
+}
+
+// newPlugin creates a new instance of the plugin described by p and initializes it
+func (s *sidecar) newPlugin(p api.PluginConfig) (api.Plugin, error) {
+	plugin, pluginConfig, err := decodePluginConfig(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add plugin %s,err:%w", p.Name, err)
+	}
+	if err := callPlugin(p.Name, "Init", func() error { return plugin.Init(pluginConfig, s.SidecarManager) }); err != nil {
+		return nil, fmt.Errorf("init plugin %s of type %s failed: %w", p.Name, plugin.Name(), err)
+	}
+	return plugin, nil
+}
+
+// AddPlugin adds a plugin whose type is its name
+func (s *sidecar) AddPlugin(name string, config interface{}) error {
+	return s.initPlugin(api.PluginConfig{Name: name, Config: config})
+}
+
+// decodePluginConfig creates a new instance of the plugin type of p, decodes the config
+// of p into its config type, and defaults and validates it
+func decodePluginConfig(p api.PluginConfig) (api.Plugin, interface{}, error) {
+	plugin, pluginConfig, err := decodePluginConfigWith(p, utils.ConvertJsonObjectToStruct)
+	if err != nil {
+		return nil, nil, err
 	}
-	pluginConfig := plugin.GetConfigType()
-	err := utils.ConvertJsonObjectToStruct(config, pluginConfig)
+	if err := validatePluginConfig(plugin, pluginConfig, pluginConfigPath(p, nil)).ToAggregate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return plugin, pluginConfig, nil
+}
+
+// decodePluginConfigWith decodes and defaults the config of p with the given conversion of the config map
+func decodePluginConfigWith(p api.PluginConfig, convert func(source, target interface{}) error) (api.Plugin, interface{}, error) {
+	plugin, pluginConfig, err := newPluginConfig(p, convert)
 	if err != nil {
-		return fmt.Errorf("convert plugin config failed,err:%w", err)
+		return nil, nil, err
 	}
-	if err := plugin.Init(pluginConfig, s.SidecarManager); err != nil {
-		return fmt.Errorf("init plugin %s failed", plugin.Name())
+	defaultPluginConfig(plugin, pluginConfig)
+	return plugin, pluginConfig, nil
+}
+
+// newPluginConfig creates a new instance of the plugin type of p and decodes the config of p
+func newPluginConfig(p api.PluginConfig, convert func(source, target interface{}) error) (api.Plugin, interface{}, error) {
+	factory, ok := plugins.PluginRegistry[p.PluginType()]
+	if !ok {
+		return nil, nil, fmt.Errorf("failed to find plugin type %s", p.PluginType())
+	}
+	plugin := factory()
+	var pluginConfig interface{}
+	if p.PluginType() == api.BinaryPluginType {
+		if p.Binary == nil {
+			return nil, nil, fmt.Errorf("binary is required for plugin type %s", api.BinaryPluginType)
+		}
+		pluginConfig = p.Binary.DeepCopy()
+	} else {
+		config := p.Config
+		if config == nil {
+			config = map[string]interface{}{}
+		}
+		pluginConfig = plugin.GetConfigType()
+		if err := convert(config, pluginConfig); err != nil {
+			return nil, nil, fmt.Errorf("convert plugin config failed,err:%w", err)
+		}
+	}
+	return plugin, pluginConfig, nil
+}
+
+// defaultPluginConfig applies the defaults of plugin to config if the plugin implements api.ConfigDefaulter
+func defaultPluginConfig(plugin api.Plugin, config interface{}) {
+	if defaulter, ok := plugin.(api.ConfigDefaulter); ok {
+		defaulter.DefaultConfig(config)
 	}
-	s.plugins[plugin.Name()] = plugin
-	return nil
 }
 
 func (s *sidecar) getPluginFromConfig(name string) (api.PluginConfig, bool) {
@@ -117,13 +246,15 @@ func (s *sidecar) getPluginFromConfig(name string) (api.PluginConfig, bool) {
 
 // GetVersion implements api.Sidecar.
 func (s *sidecar) GetVersion() string {
-	// get version from git
 	return s.version
 }
 
 // PluginStatus implements api.Sidecar.
 func (s *sidecar) PluginStatus(pluginName string) (*api.PluginStatus, error) {
-	if status, ok := s.pluginStatuses[pluginName]; ok {
+	s.lock.RLock()
+	status, ok := s.pluginStatuses[pluginName]
+	s.lock.RUnlock()
+	if ok {
 		return status, nil
 	}
 	return s.updatePluginStatus(pluginName)
@@ -132,76 +263,243 @@ func (s *sidecar) PluginStatus(pluginName string) (*api.PluginStatus, error) {
 func (s *sidecar) updatePluginStatus(pluginName string) (*api.PluginStatus, error) {
 	s.log.V(3).Info("start polling plugin status", "plugin", pluginName)
 	defer s.log.V(3).Info("end polling plugin status", "plugin", pluginName)
+	s.lock.RLock()
 	plugin, ok := s.plugins[pluginName]
+	s.lock.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("plugin %s not found", pluginName)
 	}
-	status, err := plugin.Status()
+	var status *api.PluginStatus
+	err := callPlugin(pluginName, "Status", func() (err error) {
+		status, err = plugin.Status()
+		return err
+	})
+	var panicErr *utils.PanicError
+	if errors.As(err, &panicErr) {
+		// 记录 panic，插件在状态恢复前被视为不健康
+		panicStatus := &api.PluginStatus{
+			Name:       pluginName,
+			LastError:  err.Error(),
+			ErrorCount: 1,
+			PanicStack: panicErr.Stack,
+		}
+		panicStatus.SetCondition(api.ConditionReady, metav1.ConditionFalse, api.ReasonPanicked, err.Error())
+		panicStatus.SetCondition(api.ConditionDegraded, metav1.ConditionTrue, api.ReasonPanicked, err.Error())
+		s.lock.Lock()
+		if prev, ok := s.pluginStatuses[pluginName]; ok {
+			panicStatus.ErrorCount += prev.ErrorCount
+			carryTransitionTimes(prev, panicStatus)
+		}
+		s.pluginStatuses[pluginName] = panicStatus
+		s.lock.Unlock()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("get plugin %s status failed", pluginName)
+		return nil, fmt.Errorf("get plugin %s status failed: %w", pluginName, err)
+	}
+	// 插件上报的是类型名，状态使用实例名
+	status = status.DeepCopy()
+	status.Name = pluginName
+	if status.Version == "" {
+		status.Version = plugin.Version()
 	}
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	if sup, ok := s.supervisors[pluginName]; ok {
+		status = sup.annotate(status)
+	}
+	if prev, ok := s.pluginStatuses[pluginName]; ok {
+		carryTransitionTimes(prev, status)
+	}
 	s.pluginStatuses[pluginName] = status
 	return status, nil
 }
 
+// carryTransitionTimes keeps the lastTransitionTime of the conditions of prev whose status did
+// not change, because plugins report a new status on every poll
+func carryTransitionTimes(prev, status *api.PluginStatus) {
+	for i := range status.Conditions {
+		condition := &status.Conditions[i]
+		if old := prev.GetCondition(condition.Type); old != nil && old.Status == condition.Status {
+			condition.LastTransitionTime = old.LastTransitionTime
+		}
+	}
+}
+
 // RemovePlugin implements api.Sidecar.
+// The plugin is removed under the lock and stopped after the lock is released, so status
+// queries are served while it stops.
 func (s *sidecar) RemovePlugin(pluginName string) error {
-	//lock and remove
 	s.lock.Lock()
-	defer s.lock.Unlock()
-	if plugin, ok := s.plugins[pluginName]; ok {
-		if err := plugin.Stop(context.Background()); err != nil {
-			return fmt.Errorf("stop plugin %s failed", pluginName)
-		}
-		delete(s.plugins, pluginName)
-		return nil
+	if _, ok := s.plugins[pluginName]; !ok {
+		s.lock.Unlock()
+		return fmt.Errorf("plugin %s not found", pluginName)
+	}
+	stopper := s.stopperOf(pluginName)
+	delete(s.plugins, pluginName)
+	delete(s.supervisors, pluginName)
+	delete(s.pluginStatuses, pluginName)
+	s.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout(stopper.plugin))
+	defer cancel()
+	if err := stopper.stop(ctx); err != nil {
+		return fmt.Errorf("stop plugin %s failed: %w", pluginName, err)
 	}
-	return fmt.Errorf("plugin %s not found", pluginName)
+	return nil
 }
 
 // Start implements api.Sidecar.
+// Start blocks until ctx is cancelled, then stops all plugins in order. Failed plugins are
+// restarted by their supervisor according to the restart policy and never stop the sidecar.
 func (s *sidecar) Start(ctx context.Context) error {
 	// start all plugins
 	s.log.Info("start sidecar")
-	errorCh := make(chan error)
-	s.startAllPlugins(ctx, errorCh)
-	for _, plugin := range s.plugins {
-		s.pollPluginStatus(plugin.Name(), time.Second*30)
-		time.Sleep(time.Second)
+	// 插件使用独立的 context，收到退出信号后由 Stop 按顺序停止，而不是同时被取消
+	pluginCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.lock.Lock()
+	s.pluginCtx = pluginCtx
+	s.lock.Unlock()
+	if err := s.registerHealthHandlers(); err != nil {
+		return fmt.Errorf("failed to register health checks: %w", err)
+	}
+	if err := store.RegisterCollector(s.SidecarManager, &statusCollector{s: s}); err != nil {
+		return fmt.Errorf("failed to register plugin status metrics: %w", err)
 	}
 	if s.isStartWebServer {
-		// start server
-		go s.startServer()
+		if err := s.registerAdminHandlers(); err != nil {
+			return fmt.Errorf("failed to register admin api: %w", err)
+		}
+	}
+	// HTTP 服务先于插件启动，便于通过管理接口排查启动阶段卡住的插件
+	defer s.shutdownHTTPServers()
+	if err := s.SidecarManager.StartHTTPServers(); err != nil {
+		return fmt.Errorf("failed to start http servers: %w", err)
+	}
+	// 状态轮询在启动插件之前开始，启动阶段等待期间 /livez 同样有效
+	s.heartbeat()
+	go s.pollPluginStatus(pluginCtx, pluginStatusPollInterval)
+	go s.syncPodStatus(pluginCtx)
+	go s.annotateVersion(pluginCtx)
+	if err := s.startAllPlugins(ctx, pluginCtx); err != nil {
+		s.log.Error(err, "failed to start plugins")
+		if stopErr := s.Stop(context.Background()); stopErr != nil {
+			s.log.Error(stopErr, "failed to stop sidecar")
+		}
+		return err
+	}
+	if s.configPath != "" {
+		go s.watchConfig(ctx, pluginCtx)
 	}
 	s.log.Info("sidecar started successfully")
-	// wait for error
-	err := <-errorCh
-	s.log.Error(err, "plugin error")
-	return err
+	// wait for shutdown signal
+	<-ctx.Done()
+	s.log.Info("shutdown signal received, stopping sidecar")
+	return s.Stop(context.Background())
 }
 
-func (s *sidecar) startServer() {
-	// start server
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatalf("start web server failed: %v", err)
+// shutdownHTTPServers shuts the http servers down after all plugins are stopped
+func (s *sidecar) shutdownHTTPServers() {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginStopTimeout)
+	defer cancel()
+	if err := s.SidecarManager.ShutdownHTTPServers(ctx); err != nil {
+		s.log.Error(err, "failed to shutdown http servers")
 	}
 }
 
-// pollPluginStatus periodically polls the status of a plugin with the given time interval.
-func (s *sidecar) pollPluginStatus(pluginName string, interval time.Duration) {
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		for range ticker.C {
-			s.updatePluginStatus(pluginName)
+// EnablePlugin implements api.Sidecar.
+// The plugin is initialized from the loaded config if it is not running yet.
+func (s *sidecar) EnablePlugin(pluginName string) error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	s.lock.Lock()
+	pluginCtx := s.pluginCtx
+	_, initialized := s.plugins[pluginName]
+	delete(s.disabled, pluginName)
+	s.lock.Unlock()
+	if pluginCtx == nil {
+		return fmt.Errorf("sidecar is not started")
+	}
+	if !initialized {
+		pluginOption, ok := s.getPluginFromConfig(pluginName)
+		if !ok {
+			return fmt.Errorf("plugin %s not found", pluginName)
+		}
+		if err := s.initPlugin(pluginOption); err != nil {
+			return err
 		}
-	}()
+	}
+	if s.startPlugin(pluginCtx, pluginName) {
+		s.log.Info("plugin enabled", "plugin", pluginName)
+	}
+	return nil
+}
+
+// DisablePlugin implements api.Sidecar.
+// The plugin is stopped but kept, so it can be enabled again later.
+func (s *sidecar) DisablePlugin(pluginName string) error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	s.lock.Lock()
+	if _, ok := s.plugins[pluginName]; !ok {
+		s.lock.Unlock()
+		return fmt.Errorf("plugin %s not found", pluginName)
+	}
+	if s.disabled[pluginName] {
+		s.lock.Unlock()
+		return nil
+	}
+	stopper := s.stopperOf(pluginName)
+	delete(s.supervisors, pluginName)
+	delete(s.pluginStatuses, pluginName)
+	s.disabled[pluginName] = true
+	s.lock.Unlock()
+
+	// 停止插件时不持有锁，reloadLock 保证插件在停止完成前不会被重新启用
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout(stopper.plugin))
+	defer cancel()
+	if err := stopper.stop(ctx); err != nil {
+		return fmt.Errorf("stop plugin %s failed: %w", pluginName, err)
+	}
+	s.log.Info("plugin disabled", "plugin", pluginName)
+	return nil
+}
+
+// RestartPlugin implements api.Sidecar.
+func (s *sidecar) RestartPlugin(pluginName string) error {
+	if err := s.DisablePlugin(pluginName); err != nil {
+		return err
+	}
+	return s.EnablePlugin(pluginName)
+}
+
+// pollPluginStatus periodically polls the status of all plugins with the given time interval.
+func (s *sidecar) pollPluginStatus(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, name := range s.pluginNames() {
+				if _, err := s.updatePluginStatus(name); err != nil {
+					s.log.Error(err, "failed to update plugin status", "plugin", name)
+				}
+			}
+			s.heartbeat()
+		}
+	}
+}
+
+func (s *sidecar) pluginNames() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	names := make([]string, 0, len(s.plugins))
+	for name := range s.plugins {
+		names = append(names, name)
+	}
+	return names
 }
 
 func (s *sidecar) isPluginEnabled(pluginName string) bool {
@@ -212,39 +510,248 @@ func (s *sidecar) isPluginEnabled(pluginName string) bool {
 	return pluginOption.BootOrder > 0
 }
 
-func (s *sidecar) startAllPlugins(ctx context.Context, errorCh chan<- error) {
-	for _, plugin := range s.plugins {
-		s.log.Info("start plugin", "plugin", plugin.Name())
-		if s.isPluginRunning(plugin.Name()) {
+// startAllPlugins starts plugins stage by stage in ascending BootOrder, see buildBootStages.
+// Plugins that already have a supervisor are skipped. A stage is started only after every
+// plugin started in the previous stage is running and healthy. Waiting is aborted when ctx
+// is cancelled or a plugin of the stage exits for good.
+func (s *sidecar) startAllPlugins(ctx, pluginCtx context.Context) error {
+	stages := s.bootStages()
+	for i, stage := range stages {
+		var started []string
+		for _, name := range stage {
+			if s.startPlugin(pluginCtx, name) {
+				started = append(started, name)
+			}
+		}
+		if len(started) == 0 {
 			continue
 		}
-		go plugin.Start(ctx, errorCh)
-		s.log.Info("plugin started successfully", "plugin", plugin.Name())
+		s.log.Info("boot stage started", "stage", i, "plugins", started)
+		if i == len(stages)-1 {
+			break
+		}
+		if err := s.waitForStage(ctx, started); err != nil {
+			return fmt.Errorf("boot stage %d failed: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// startPlugin starts the plugin under a supervisor and reports whether it was started.
+// Nothing is done if the plugin already has a supervisor or has been disabled.
+func (s *sidecar) startPlugin(ctx context.Context, name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.supervisors[name]; ok || s.disabled[name] {
+		return false
+	}
+	s.log.Info("start plugin", "plugin", name)
+	sup := newSupervisor(name, s.plugins[name], s.restartPolicy(name), s.log)
+	s.supervisors[name] = sup
+	sup.start(ctx)
+	s.log.Info("plugin started successfully", "plugin", name)
+	return true
+}
+
+func (s *sidecar) supervisor(name string) *supervisor {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.supervisors[name]
+}
+
+func (s *sidecar) isDisabled(name string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.disabled[name]
+}
+
+// pluginStopper stops a plugin and its supervisor. It is taken under the lock, so the plugin
+// can be stopped without holding the lock while it shuts down.
+type pluginStopper struct {
+	name   string
+	plugin api.Plugin
+	sup    *supervisor
+}
+
+// stopperOf returns the stopper of the plugin, caller must hold the lock
+func (s *sidecar) stopperOf(name string) pluginStopper {
+	return pluginStopper{name: name, plugin: s.plugins[name], sup: s.supervisors[name]}
+}
+
+func (p pluginStopper) stop(ctx context.Context) error {
+	if p.sup != nil {
+		return p.sup.stop(ctx)
+	}
+	return callPlugin(p.name, "Stop", func() error { return p.plugin.Stop(ctx) })
+}
+
+// stopTimeout returns the time the plugin is given to stop, which is extended for plugins that
+// need longer to stop gracefully
+func stopTimeout(plugin api.Plugin) time.Duration {
+	if stopper, ok := plugin.(api.GracefulStopper); ok && stopper.StopTimeout() > pluginStopTimeout {
+		return stopper.StopTimeout()
+	}
+	return pluginStopTimeout
+}
+
+// restartPolicy returns the restart policy of the plugin, falling back to the sidecar's
+func (s *sidecar) restartPolicy(name string) string {
+	if pluginOption, ok := s.getPluginFromConfig(name); ok && pluginOption.RestartPolicy != "" {
+		return pluginOption.RestartPolicy
+	}
+	if s.SidecarConfig.RestartPolicy != "" {
+		return s.SidecarConfig.RestartPolicy
 	}
+	return api.RestartPolicyAlways
+}
+
+func validateRestartPolicies(config *api.SidecarConfig) error {
+	if err := validateRestartPolicy(config.RestartPolicy); err != nil {
+		return err
+	}
+	for _, p := range config.Plugins {
+		if err := validateRestartPolicy(p.RestartPolicy); err != nil {
+			return fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateRestartPolicy(policy string) error {
+	switch policy {
+	case "", api.RestartPolicyAlways, api.RestartPolicyOnFailure, api.RestartPolicyNever:
+		return nil
+	default:
+		return fmt.Errorf("unknown restart policy %q", policy)
+	}
+}
+
+// bootStages returns the boot stages of the plugins that have been initialized
+func (s *sidecar) bootStages() [][]string {
+	var stages [][]string
+	for _, stage := range s.stages {
+		var names []string
+		for _, name := range stage {
+			if _, ok := s.plugins[name]; ok {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			stages = append(stages, names)
+		}
+	}
+	return stages
+}
+
+// waitForStage blocks until every plugin in stage is running and healthy
+func (s *sidecar) waitForStage(ctx context.Context, stage []string) error {
+	timeout := defaultStageTimeout
+	if s.SidecarConfig.StageTimeoutSeconds > 0 {
+		timeout = time.Duration(s.SidecarConfig.StageTimeoutSeconds) * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(stagePollInterval)
+	defer ticker.Stop()
+	for {
+		var pending []string
+		for _, name := range stage {
+			if s.isDisabled(name) {
+				continue
+			}
+			if sup := s.supervisor(name); sup == nil || !sup.isRunning() {
+				return fmt.Errorf("plugin %s exited before it was ready", name)
+			}
+			status, err := s.updatePluginStatus(name)
+			if err != nil || !isPluginHealthy(status) {
+				pending = append(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		s.log.V(1).Info("waiting for plugins to be ready", "plugins", pending)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return fmt.Errorf("timeout after %s waiting for plugins %v to be ready", timeout, pending)
+		case <-ticker.C:
+		}
+	}
+}
+
+// isPluginHealthy reports whether the plugin is running and its Ready condition is not false
+func isPluginHealthy(status *api.PluginStatus) bool {
+	return status.IsReady()
 }
 
 // Stop implements api.Sidecar.
 func (s *sidecar) Stop(ctx context.Context) error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
 	// stop all plugins
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Second*20)
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, s.stopAllTimeout())
 	defer cancel()
 	if err := s.StopAllPlugins(ctxWithTimeout); err != nil {
-		return fmt.Errorf("stop all plugins failed")
+		return fmt.Errorf("stop all plugins failed: %w", err)
 	}
+	s.log.Info("sidecar stopped")
 	return nil
 }
 
-// StopAllPlugins implements api.Sidecar.
+// stopAllTimeout returns the time given to stop all plugins. Plugins are stopped one after
+// another, so it is the sum of their stop timeouts, and at least defaultStopTimeout.
+func (s *sidecar) stopAllTimeout() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var timeout time.Duration
+	for _, plugin := range s.plugins {
+		timeout += stopTimeout(plugin)
+	}
+	return max(timeout, defaultStopTimeout)
+}
+
+// StopAllPlugins stops plugins in reverse boot order, giving each plugin its own deadline.
+// A plugin that fails to stop does not prevent the remaining plugins from being stopped.
+// The lock is only held to collect the plugins, so status queries are served while they stop.
 func (s *sidecar) StopAllPlugins(ctx context.Context) error {
-	panic("unimplemented")
+	s.lock.RLock()
+	order := s.stopOrder()
+	stoppers := make([]pluginStopper, 0, len(order))
+	for _, name := range order {
+		stoppers = append(stoppers, s.stopperOf(name))
+	}
+	s.lock.RUnlock()
+
+	var errs []error
+	for _, p := range stoppers {
+		name := p.name
+		s.log.Info("stop plugin", "plugin", name)
+		stopCtx, cancel := context.WithTimeout(ctx, stopTimeout(p.plugin))
+		err := p.stop(stopCtx)
+		cancel()
+		if err != nil {
+			s.log.Error(err, "failed to stop plugin", "plugin", name)
+			errs = append(errs, fmt.Errorf("stop plugin %s failed: %w", name, err))
+			continue
+		}
+		s.log.Info("plugin stopped successfully", "plugin", name)
+	}
+	return errors.Join(errs...)
 }
 
-func (s *sidecar) isPluginRunning(pluginName string) bool {
-	status, err := s.PluginStatus(pluginName)
-	if err != nil {
-		return false
+// stopOrder returns plugin names in reverse boot order, so dependents stop before their dependencies.
+// Plugins outside of the boot stages, e.g. enabled through the admin API, are stopped first.
+// Caller must hold the lock.
+func (s *sidecar) stopOrder() []string {
+	order := reverseStages(s.bootStages())
+	var extra []string
+	for name := range s.plugins {
+		if indexOf(order, name) < 0 {
+			extra = append(extra, name)
+		}
 	}
-	return status.Running
+	sort.Strings(extra)
+	return append(extra, order...)
 }
@@ -0,0 +1,116 @@
+package assembler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// blockingPlugin blocks in Stop until release is closed
+type blockingPlugin struct {
+	stopping chan struct{}
+	release  chan struct{}
+}
+
+func newBlockingPlugin() *blockingPlugin {
+	return &blockingPlugin{stopping: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (p *blockingPlugin) Name() string                               { return "blocking" }
+func (p *blockingPlugin) Init(interface{}, api.SidecarManager) error { return nil }
+func (p *blockingPlugin) Start(context.Context, chan<- error)        {}
+func (p *blockingPlugin) Version() string                            { return "v0.0.1" }
+func (p *blockingPlugin) GetConfigType() interface{}                 { return &struct{}{} }
+func (p *blockingPlugin) Stop(ctx context.Context) error {
+	close(p.stopping)
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+	}
+	return nil
+}
+func (p *blockingPlugin) Status() (*api.PluginStatus, error) {
+	status := &api.PluginStatus{Name: "blocking", Running: true}
+	status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "Running", "")
+	return status, nil
+}
+
+// slowPlugin stops within timeout, see api.GracefulStopper
+type slowPlugin struct {
+	blockingPlugin
+	timeout time.Duration
+}
+
+func (p *slowPlugin) StopTimeout() time.Duration { return p.timeout }
+
+// assertUnlockedWhileStopping runs stop and checks that the lock of the sidecar is free while
+// the plugin is stopping
+func assertUnlockedWhileStopping(t *testing.T, s *sidecar, plugin *blockingPlugin, stop func() error) {
+	t.Helper()
+	errCh := make(chan error, 1)
+	go func() { errCh <- stop() }()
+	select {
+	case <-plugin.stopping:
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin was not stopped")
+	}
+	locked := make(chan struct{})
+	go func() {
+		s.lock.Lock()
+		s.lock.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("lock is held while the plugin is stopping")
+	}
+	close(plugin.release)
+	if err := <-errCh; err != nil {
+		t.Errorf("stop error = %v", err)
+	}
+}
+
+func TestStopDoesNotHoldLock(t *testing.T) {
+	plugin := newBlockingPlugin()
+	s := NewSidecar().(*sidecar)
+	s.SidecarConfig = &api.SidecarConfig{}
+	s.plugins["blocking"] = plugin
+	assertUnlockedWhileStopping(t, s, plugin, func() error { return s.Stop(context.Background()) })
+}
+
+func TestRemovePluginDoesNotHoldLock(t *testing.T) {
+	plugin := newBlockingPlugin()
+	s := NewSidecar().(*sidecar)
+	s.plugins["blocking"] = plugin
+	assertUnlockedWhileStopping(t, s, plugin, func() error { return s.RemovePlugin("blocking") })
+	if _, ok := s.plugins["blocking"]; ok {
+		t.Error("plugin was not removed")
+	}
+}
+
+func TestDisablePluginDoesNotHoldLock(t *testing.T) {
+	plugin := newBlockingPlugin()
+	s := NewSidecar().(*sidecar)
+	s.plugins["blocking"] = plugin
+	assertUnlockedWhileStopping(t, s, plugin, func() error { return s.DisablePlugin("blocking") })
+	if !s.disabled["blocking"] {
+		t.Error("plugin was not disabled")
+	}
+}
+
+func TestStopAllTimeout(t *testing.T) {
+	s := NewSidecar().(*sidecar)
+	if got := s.stopAllTimeout(); got != defaultStopTimeout {
+		t.Errorf("stopAllTimeout() without plugins = %s, want %s", got, defaultStopTimeout)
+	}
+	s.plugins["a"] = &slowPlugin{timeout: 35 * time.Second}
+	s.plugins["b"] = &slowPlugin{timeout: 15 * time.Second}
+	s.plugins["c"] = newBlockingPlugin()
+	if got, want := s.stopAllTimeout(), 55*time.Second; got != want {
+		t.Errorf("stopAllTimeout() = %s, want %s", got, want)
+	}
+}
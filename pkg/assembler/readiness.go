@@ -0,0 +1,156 @@
+package assembler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/info"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// podStatusSyncInterval 是同步 pod readiness gate 条件和插件状态注解的间隔
+const podStatusSyncInterval = 5 * time.Second
+
+// pluginSummary is the view of a plugin status in the kidecar.io/plugin-status annotation
+type pluginSummary struct {
+	Conditions map[string]metav1.ConditionStatus `json:"conditions"`
+	// Reason 是插件未就绪时 Ready 条件的原因
+	Reason       string `json:"reason,omitempty"`
+	RestartCount int    `json:"restartCount,omitempty"`
+}
+
+// syncPodStatus publishes the plugin statuses on the current pod: the kidecar.io/plugin-status
+// annotation is kept in sync with the status of every plugin, and the kidecar.io/plugins-ready
+// condition with the aggregated plugin health if the pod has that readiness gate.
+func (s *sidecar) syncPodStatus(ctx context.Context) {
+	nsname, err := info.GetCurrentPodNamespaceAndName()
+	if err != nil {
+		s.log.V(1).Info("not running in a pod, skip syncing pod status", "reason", err.Error())
+		return
+	}
+	pod, err := s.SidecarManager.CoreV1().Pods(nsname.Namespace).Get(ctx, nsname.Name, metav1.GetOptions{})
+	if err != nil {
+		s.log.Error(err, "failed to get current pod, skip syncing pod status")
+		return
+	}
+	readinessGate := hasReadinessGate(pod, v1alpha1.PluginsReadyConditionType)
+	if readinessGate {
+		s.log.Info("syncing readiness gate", "condition", v1alpha1.PluginsReadyConditionType)
+	}
+
+	ticker := time.NewTicker(podStatusSyncInterval)
+	defer ticker.Stop()
+	var synced *corev1.ConditionStatus
+	var annotated map[string]pluginSummary
+	for {
+		// 只在状态变化时更新 pod，更新失败时下一轮重试
+		if readinessGate {
+			reasons := s.notReadyPlugins()
+			status := corev1.ConditionTrue
+			if len(reasons) > 0 {
+				status = corev1.ConditionFalse
+			}
+			if synced == nil || *synced != status {
+				if err := s.patchPluginsReadyCondition(ctx, nsname, status, reasons); err != nil {
+					s.log.Error(err, "failed to patch readiness gate condition")
+				} else {
+					s.log.Info("readiness gate condition updated", "status", status)
+					synced = &status
+				}
+			}
+		}
+		if summaries := s.pluginSummaries(); !reflect.DeepEqual(summaries, annotated) {
+			if err := s.patchPluginStatusAnnotation(ctx, nsname, summaries); err != nil {
+				s.log.Error(err, "failed to patch plugin status annotation")
+			} else {
+				annotated = summaries
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pluginSummaries returns the summaries of the last polled plugin statuses
+func (s *sidecar) pluginSummaries() map[string]pluginSummary {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	summaries := make(map[string]pluginSummary, len(s.pluginStatuses))
+	for name, status := range s.pluginStatuses {
+		summary := pluginSummary{
+			Conditions:   make(map[string]metav1.ConditionStatus, len(status.Conditions)),
+			RestartCount: status.RestartCount,
+		}
+		for _, condition := range status.Conditions {
+			summary.Conditions[condition.Type] = condition.Status
+		}
+		if ready := status.GetCondition(api.ConditionReady); ready != nil && ready.Status != metav1.ConditionTrue {
+			summary.Reason = ready.Reason
+		}
+		summaries[name] = summary
+	}
+	return summaries
+}
+
+func (s *sidecar) patchPluginStatusAnnotation(ctx context.Context, nsname *types.NamespacedName, summaries map[string]pluginSummary) error {
+	value, err := json.Marshal(summaries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plugin summaries: %w", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				v1alpha1.PluginStatusAnnotation: string(value),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal annotation patch: %w", err)
+	}
+	_, err = s.SidecarManager.CoreV1().Pods(nsname.Namespace).Patch(ctx, nsname.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (s *sidecar) patchPluginsReadyCondition(ctx context.Context, nsname *types.NamespacedName, status corev1.ConditionStatus, reasons []string) error {
+	condition := corev1.PodCondition{
+		Type:               v1alpha1.PluginsReadyConditionType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "PluginsReady",
+		Message:            "all plugins are ready",
+	}
+	if status != corev1.ConditionTrue {
+		condition.Reason = "PluginsNotReady"
+		condition.Message = strings.Join(reasons, "; ")
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.PodCondition{condition},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal condition patch: %w", err)
+	}
+	_, err = s.SidecarManager.CoreV1().Pods(nsname.Namespace).Patch(ctx, nsname.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+func hasReadinessGate(pod *corev1.Pod, conditionType corev1.PodConditionType) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == conditionType {
+			return true
+		}
+	}
+	return false
+}
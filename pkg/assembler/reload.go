@@ -0,0 +1,267 @@
+package assembler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/magicsong/kidecar/api"
+)
+
+// configReloadDebounce 合并短时间内的多次文件变更事件
+const configReloadDebounce = time.Second
+
+// configDiff describes how a new config differs from the running one
+type configDiff struct {
+	added   []api.PluginConfig
+	removed []string
+	// changed plugins are stopped, initialized again and restarted
+	changed []api.PluginConfig
+	// reloaded plugins implement api.ConfigReloader and only their config changed
+	reloaded map[string]interface{}
+}
+
+func (d *configDiff) empty() bool {
+	return len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0 && len(d.reloaded) == 0
+}
+
+// watchConfig watches the config file and reloads the plugins when it changes.
+// The directory is watched instead of the file, because kubelet updates ConfigMap volumes
+// by swapping the ..data symlink rather than writing to the file.
+func (s *sidecar) watchConfig(ctx, pluginCtx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		s.log.Error(err, "failed to create config watcher, config reload is disabled")
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(s.configPath)); err != nil {
+		s.log.Error(err, "failed to watch config, config reload is disabled", "path", s.configPath)
+		return
+	}
+	s.log.Info("watching config for changes", "path", s.configPath)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			s.log.V(1).Info("config directory changed", "event", event.String())
+			debounce = time.After(configReloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.log.Error(err, "config watcher error")
+		case <-debounce:
+			debounce = nil
+			if err := s.reloadConfig(ctx, pluginCtx); err != nil {
+				s.log.Error(err, "failed to reload config")
+			}
+		}
+	}
+}
+
+// reloadConfig re-reads the config file and applies the difference to the running plugins.
+// The new config is fully parsed and validated before any running plugin is touched, so a
+// failed reload leaves the running plugins as they are.
+func (s *sidecar) reloadConfig(ctx, pluginCtx context.Context) error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	if ctx.Err() != nil {
+		return nil
+	}
+	err := s.applyConfigFile(ctx, pluginCtx)
+	s.lock.Lock()
+	s.lastReloadError = err
+	s.lock.Unlock()
+	return err
+}
+
+func (s *sidecar) applyConfigFile(ctx, pluginCtx context.Context) error {
+	config, stages, hash, err := parseConfig(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config from path %s: %w", s.configPath, err)
+	}
+	if hash == s.configHash {
+		return nil
+	}
+	diff, err := s.diffConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid config %s: %w", s.configPath, err)
+	}
+	if diff.empty() {
+		s.setConfig(config, stages, hash)
+		s.log.Info("config changed without affecting plugins", "hash", hash)
+		return nil
+	}
+	s.log.Info("config changed, reloading plugins", "hash", hash, "added", pluginNamesOf(diff.added),
+		"removed", diff.removed, "changed", pluginNamesOf(diff.changed), "reloaded", len(diff.reloaded))
+
+	// 先初始化新的插件实例，初始化失败的插件保留正在运行的旧实例
+	var errs []error
+	var failed []string
+	fresh := make(map[string]api.Plugin)
+	for _, p := range append(diff.changed, diff.added...) {
+		plugin, err := s.newPlugin(p)
+		if err != nil {
+			errs = append(errs, err)
+			failed = append(failed, p.Name)
+			continue
+		}
+		fresh[p.Name] = plugin
+	}
+	if len(failed) > 0 {
+		// 保留旧配置的插件可能有不同的 DependsOn 和 BootOrder，启动和停止顺序按实际运行的配置计算
+		config = s.keepFailedPlugins(config, failed)
+		if stages, err = buildBootStages(config.Plugins); err != nil {
+			errs = append(errs, fmt.Errorf("invalid plugin dependencies with the running config of %v: %w", failed, err))
+			return fmt.Errorf("config not reloaded: %w", errors.Join(errs...))
+		}
+	}
+
+	// 只有配置变化的插件在提交新配置前重新加载，重新加载失败的插件保留旧配置，下一次文件变更时重试
+	for name, pluginConfig := range diff.reloaded {
+		s.lock.RLock()
+		plugin := s.plugins[name]
+		s.lock.RUnlock()
+		reload := func() error { return plugin.(api.ConfigReloader).Reload(pluginConfig) }
+		if err := callPlugin(name, "Reload", reload); err != nil {
+			errs = append(errs, fmt.Errorf("reload plugin %s failed: %w", name, err))
+			failed = append(failed, name)
+			config = s.keepFailedPlugins(config, []string{name})
+		}
+	}
+	if len(failed) > 0 {
+		// 配置没有完全生效，保留旧的哈希，下一次文件变更时重试
+		hash = s.configHash
+	}
+
+	// stop removed plugins and changed plugins replaced by a new instance, dependents first
+	stopping := make(map[string]bool)
+	for _, name := range diff.removed {
+		stopping[name] = true
+	}
+	for _, p := range diff.changed {
+		if _, ok := fresh[p.Name]; ok {
+			stopping[p.Name] = true
+		}
+	}
+	s.lock.RLock()
+	order := s.stopOrder()
+	s.lock.RUnlock()
+	for _, name := range order {
+		if !stopping[name] {
+			continue
+		}
+		if err := s.RemovePlugin(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	s.setConfig(config, stages, hash)
+
+	s.lock.Lock()
+	for name, plugin := range fresh {
+		s.plugins[name] = plugin
+	}
+	s.lock.Unlock()
+	if err := s.startAllPlugins(ctx, pluginCtx); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config reloaded with errors: %w", errors.Join(errs...))
+	}
+	s.log.Info("config reloaded successfully", "hash", hash)
+	return nil
+}
+
+// keepFailedPlugins returns a copy of config in which the running plugins that failed to be
+// initialized or reloaded keep their running config, so they are compared against it on the
+// next reload. Failed plugins that are not running yet keep the new config and are added again.
+func (s *sidecar) keepFailedPlugins(config *api.SidecarConfig, failed []string) *api.SidecarConfig {
+	kept := *config
+	kept.Plugins = make([]api.PluginConfig, len(config.Plugins))
+	copy(kept.Plugins, config.Plugins)
+	for _, name := range failed {
+		old, ok := s.getPluginFromConfig(name)
+		if !ok {
+			continue
+		}
+		for i := range kept.Plugins {
+			if kept.Plugins[i].Name == name {
+				kept.Plugins[i] = old
+			}
+		}
+	}
+	return &kept
+}
+
+func (s *sidecar) setConfig(config *api.SidecarConfig, stages [][]string, hash string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.SidecarConfig = config
+	s.stages = stages
+	s.configHash = hash
+}
+
+// diffConfig compares config with the running plugins. The config of every added or
+// changed plugin is decoded, so invalid plugin configs are rejected before anything is applied.
+func (s *sidecar) diffConfig(config *api.SidecarConfig) (*configDiff, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	diff := &configDiff{reloaded: make(map[string]interface{})}
+	desired := make(map[string]bool)
+	for _, p := range config.Plugins {
+		if p.BootOrder <= 0 {
+			continue
+		}
+		desired[p.Name] = true
+		_, pluginConfig, err := decodePluginConfig(p)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+		plugin, running := s.plugins[p.Name]
+		if !running {
+			diff.added = append(diff.added, p)
+			continue
+		}
+		old, _ := s.getPluginFromConfig(p.Name)
+		if reflect.DeepEqual(old, p) {
+			continue
+		}
+		if _, ok := plugin.(api.ConfigReloader); ok && p.Binary == nil && onlyConfigChanged(old, p) {
+			diff.reloaded[p.Name] = pluginConfig
+			continue
+		}
+		diff.changed = append(diff.changed, p)
+	}
+	for name := range s.plugins {
+		if !desired[name] {
+			diff.removed = append(diff.removed, name)
+		}
+	}
+	return diff, nil
+}
+
+// onlyConfigChanged reports whether old and p differ in nothing but Config
+func onlyConfigChanged(old, p api.PluginConfig) bool {
+	old.Config = p.Config
+	return reflect.DeepEqual(old, p)
+}
+
+func pluginNamesOf(configs []api.PluginConfig) []string {
+	names := make([]string, 0, len(configs))
+	for _, p := range configs {
+		names = append(names, p.Name)
+	}
+	return names
+}
@@ -0,0 +1,335 @@
+package assembler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/plugins"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiffConfig(t *testing.T) {
+	probeConfig := func(url string) map[string]interface{} {
+		return map[string]interface{}{
+			"endpoints": []interface{}{map[string]interface{}{
+				"url":           url,
+				"storageConfig": map[string]interface{}{"type": "HTTPMetric", "httpMetric": map[string]interface{}{"metricName": "probe"}},
+			}},
+		}
+	}
+	running := &api.SidecarConfig{
+		Plugins: []api.PluginConfig{
+			{Name: "proxy", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/proxy"}},
+			{Name: "helper", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/helper"}},
+			{Name: "http_probe", BootOrder: 2, Config: probeConfig("http://localhost:8001")},
+		},
+	}
+	tests := []struct {
+		name         string
+		plugins      []api.PluginConfig
+		wantAdded    []string
+		wantRemoved  []string
+		wantChanged  []string
+		wantReloaded []string
+		wantErr      bool
+	}{
+		{
+			name:    "unchanged",
+			plugins: running.Plugins,
+		},
+		{
+			name: "probe url changed is reloaded in place",
+			plugins: []api.PluginConfig{
+				running.Plugins[0],
+				running.Plugins[1],
+				{Name: "http_probe", BootOrder: 2, Config: probeConfig("http://localhost:9000")},
+			},
+			wantReloaded: []string{"http_probe"},
+		},
+		{
+			name: "binary changed, plugin removed and added",
+			plugins: []api.PluginConfig{
+				{Name: "proxy", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/proxy", Args: []string{"--port=8001"}}},
+				{Name: "http_probe", BootOrder: 2, Config: probeConfig("http://localhost:8001")},
+				{Name: "other", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/other"}},
+			},
+			wantAdded:   []string{"other"},
+			wantRemoved: []string{"helper"},
+			wantChanged: []string{"proxy"},
+		},
+		{
+			name: "disabling a plugin removes it",
+			plugins: []api.PluginConfig{
+				running.Plugins[0],
+				running.Plugins[1],
+				{Name: "http_probe", BootOrder: 0, Config: probeConfig("http://localhost:8001")},
+			},
+			wantRemoved: []string{"http_probe"},
+		},
+		{
+			name: "second instance of a plugin type is added",
+			plugins: append(append([]api.PluginConfig{}, running.Plugins...),
+				api.PluginConfig{Name: "probe-b", Type: "http_probe", BootOrder: 2, Config: probeConfig("http://localhost:9000")}),
+			wantAdded: []string{"probe-b"},
+		},
+		{
+			name: "changing the type of a plugin restarts it",
+			plugins: []api.PluginConfig{
+				running.Plugins[0],
+				{Name: "helper", Type: "http_probe", BootOrder: 1, Config: probeConfig("http://localhost:9000")},
+				running.Plugins[2],
+			},
+			wantChanged: []string{"helper"},
+		},
+		{
+			name: "unknown plugin is rejected",
+			plugins: []api.PluginConfig{
+				{Name: "not_exist", BootOrder: 1, Config: map[string]interface{}{}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSidecar().(*sidecar)
+			s.SidecarConfig = running
+			for _, p := range running.Plugins {
+				s.plugins[p.Name] = plugins.PluginRegistry[p.PluginType()]()
+			}
+			diff, err := s.diffConfig(&api.SidecarConfig{Plugins: tt.plugins})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("diffConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var reloaded []string
+			for name := range diff.reloaded {
+				reloaded = append(reloaded, name)
+			}
+			sort.Strings(diff.removed)
+			for _, c := range []struct {
+				kind      string
+				got, want []string
+			}{
+				{"added", pluginNamesOf(diff.added), tt.wantAdded},
+				{"removed", diff.removed, tt.wantRemoved},
+				{"changed", pluginNamesOf(diff.changed), tt.wantChanged},
+				{"reloaded", reloaded, tt.wantReloaded},
+			} {
+				if len(c.got) == 0 && len(c.want) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(c.got, c.want) {
+					t.Errorf("diffConfig() %s = %v, want %v", c.kind, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeepFailedPlugins(t *testing.T) {
+	running := &api.SidecarConfig{
+		Plugins: []api.PluginConfig{
+			{Name: "proxy", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/proxy"}},
+			{Name: "helper", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/helper"}},
+		},
+	}
+	config := &api.SidecarConfig{
+		Plugins: []api.PluginConfig{
+			{Name: "proxy", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/proxy", Args: []string{"--port=8001"}}},
+			{Name: "helper", BootOrder: 1, Binary: &v1alpha1.Binary{Path: "/bin/helper", Args: []string{"-v"}}},
+		},
+	}
+	s := NewSidecar().(*sidecar)
+	s.SidecarConfig = running
+	// helper 的新实例初始化失败，继续使用旧配置运行
+	kept := s.keepFailedPlugins(config, []string{"helper"})
+
+	if !reflect.DeepEqual(kept.Plugins[0], config.Plugins[0]) {
+		t.Errorf("proxy = %+v, want the new config", kept.Plugins[0])
+	}
+	if !reflect.DeepEqual(kept.Plugins[1], running.Plugins[1]) {
+		t.Errorf("helper = %+v, want the running config", kept.Plugins[1])
+	}
+	if len(config.Plugins[1].Binary.Args) != 1 {
+		t.Error("keepFailedPlugins modified the new config")
+	}
+}
+
+const reloadTestPluginType = "reload-test"
+
+func init() {
+	plugins.RegisterPlugin(func() api.Plugin { return &reloadTestPlugin{} })
+}
+
+type reloadTestConfig struct {
+	FailInit bool   `json:"failInit"`
+	Value    string `json:"value"`
+}
+
+// reloadTestPlugin fails Init if its config says so, and fails Reload while reloadFailures is positive
+type reloadTestPlugin struct {
+	mu     sync.Mutex
+	config reloadTestConfig
+}
+
+var reloadFailures struct {
+	sync.Mutex
+	count int
+}
+
+func (p *reloadTestPlugin) Name() string { return reloadTestPluginType }
+func (p *reloadTestPlugin) Init(config interface{}, _ api.SidecarManager) error {
+	cfg := config.(*reloadTestConfig)
+	if cfg.FailInit {
+		return errors.New("init failed")
+	}
+	p.config = *cfg
+	return nil
+}
+func (p *reloadTestPlugin) Start(ctx context.Context, _ chan<- error) { <-ctx.Done() }
+func (p *reloadTestPlugin) Stop(context.Context) error                { return nil }
+func (p *reloadTestPlugin) Version() string                           { return "v0.0.1" }
+func (p *reloadTestPlugin) GetConfigType() interface{}                { return &reloadTestConfig{} }
+func (p *reloadTestPlugin) Status() (*api.PluginStatus, error) {
+	status := &api.PluginStatus{Name: reloadTestPluginType, Running: true}
+	status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "Running", "")
+	return status, nil
+}
+func (p *reloadTestPlugin) Reload(config interface{}) error {
+	reloadFailures.Lock()
+	defer reloadFailures.Unlock()
+	if reloadFailures.count > 0 {
+		reloadFailures.count--
+		return errors.New("reload failed")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.config = *config.(*reloadTestConfig)
+	return nil
+}
+
+func (p *reloadTestPlugin) value() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.config.Value
+}
+
+// newReloadTestSidecar returns a sidecar without plugins and a function that writes config to
+// its config file and applies it
+func newReloadTestSidecar(t *testing.T) (*sidecar, func(config string) error) {
+	s := NewSidecar().(*sidecar)
+	s.SidecarConfig = &api.SidecarConfig{}
+	s.configPath = filepath.Join(t.TempDir(), "config.yaml")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		_ = s.StopAllPlugins(context.Background())
+		cancel()
+	})
+	return s, func(config string) error {
+		if err := os.WriteFile(s.configPath, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return s.applyConfigFile(ctx, ctx)
+	}
+}
+
+func TestReloadKeepsStagesOfFailedPlugins(t *testing.T) {
+	s, apply := newReloadTestSidecar(t)
+	if err := apply(`
+plugins:
+- name: db
+  type: reload-test
+  bootOrder: 1
+- name: app
+  type: reload-test
+  bootOrder: 2
+  dependsOn: [db]
+`); err != nil {
+		t.Fatal(err)
+	}
+	running := s.plugins["app"]
+	hash := s.configHash
+
+	// app 的新实例初始化失败，继续按旧的 bootOrder 和 dependsOn 运行
+	err := apply(`
+plugins:
+- name: db
+  type: reload-test
+  bootOrder: 1
+- name: app
+  type: reload-test
+  bootOrder: 1
+  config:
+    failInit: true
+`)
+	if err == nil {
+		t.Fatal("applyConfigFile() error = nil, want the init error of app")
+	}
+	if s.plugins["app"] != running {
+		t.Error("running instance of app was replaced")
+	}
+	if want := [][]string{{"db"}, {"app"}}; !reflect.DeepEqual(s.stages, want) {
+		t.Errorf("stages = %v, want %v", s.stages, want)
+	}
+	if app, _ := s.getPluginFromConfig("app"); app.BootOrder != 2 || !reflect.DeepEqual(app.DependsOn, []string{"db"}) {
+		t.Errorf("config of app = %+v, want the running config", app)
+	}
+	if s.configHash != hash {
+		t.Error("config hash was updated although app failed to init")
+	}
+}
+
+func TestReloadRetriesFailedReload(t *testing.T) {
+	s, apply := newReloadTestSidecar(t)
+	if err := apply(`
+plugins:
+- name: probe
+  type: reload-test
+  bootOrder: 1
+  config:
+    value: old
+`); err != nil {
+		t.Fatal(err)
+	}
+	plugin := s.plugins["probe"].(*reloadTestPlugin)
+	hash := s.configHash
+
+	updated := `
+plugins:
+- name: probe
+  type: reload-test
+  bootOrder: 1
+  config:
+    value: new
+`
+	reloadFailures.Lock()
+	reloadFailures.count = 1
+	reloadFailures.Unlock()
+	if err := apply(updated); err == nil {
+		t.Fatal("applyConfigFile() error = nil, want the reload error")
+	}
+	if s.configHash != hash {
+		t.Error("config hash was updated although the reload failed")
+	}
+
+	// 同一个文件再次变更时重试
+	if err := apply(updated); err != nil {
+		t.Fatalf("applyConfigFile() retry error = %v", err)
+	}
+	if got := plugin.value(); got != "new" {
+		t.Errorf("value = %q after retry, want new", got)
+	}
+	if s.configHash == hash {
+		t.Error("config hash was not updated after a successful retry")
+	}
+}
@@ -0,0 +1,278 @@
+package assembler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// initialRestartBackoff 是插件第一次重启前的等待时间，之后每次翻倍
+	initialRestartBackoff = time.Second
+	// maxRestartBackoff 是插件重启等待时间的上限
+	maxRestartBackoff = 5 * time.Minute
+	// backoffResetAfter 插件连续运行超过该时间后失败，重启等待时间会被重置
+	backoffResetAfter = 10 * time.Minute
+	// crashLoopThreshold 连续失败达到该次数后认为插件处于 CrashLoopBackOff
+	crashLoopThreshold = 5
+)
+
+// supervisor runs a single plugin and restarts it according to its restart policy.
+// Each run of the plugin gets its own error channel and context, so an error of one
+// plugin never affects the others.
+type supervisor struct {
+	name   string
+	plugin api.Plugin
+	policy string
+	log    logr.Logger
+
+	mu                  sync.Mutex
+	running             bool
+	stopping            bool
+	restartCount        int
+	consecutiveFailures int
+	errorCount          int
+	lastError           error
+	// backingOff 表示插件已退出，正在等待重启
+	backingOff bool
+	// panicked 表示插件上一次运行因 panic 退出，重新启动前插件被视为不健康
+	panicked bool
+	backoff  time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newSupervisor(name string, plugin api.Plugin, policy string, log logr.Logger) *supervisor {
+	return &supervisor{
+		name:   name,
+		plugin: plugin,
+		policy: policy,
+		log:    log.WithValues("plugin", name),
+	}
+}
+
+// start runs the plugin in the background until stop is called or ctx is cancelled
+func (p *supervisor) start(ctx context.Context) {
+	ctx = logf.IntoContext(api.WithPluginName(ctx, p.name), p.log)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	p.mu.Lock()
+	p.cancel = cancel
+	p.done = done
+	p.running = true
+	p.stopping = false
+	p.mu.Unlock()
+	go p.run(ctx, done)
+}
+
+func (p *supervisor) run(ctx context.Context, done chan struct{}) {
+	defer func() {
+		p.mu.Lock()
+		if p.done == done {
+			p.running = false
+		}
+		close(done)
+		p.mu.Unlock()
+	}()
+	for {
+		startedAt := time.Now()
+		exited, err := p.runOnce(ctx)
+		if !exited || p.isStopping() {
+			return
+		}
+		if !p.recordExit(err, time.Since(startedAt)) {
+			p.log.Info("plugin exited and will not be restarted", "restartPolicy", p.policy, "error", err)
+			return
+		}
+		delay, attempt := p.nextBackoff()
+		p.log.Info("restarting plugin", "backoff", delay.String(), "restartCount", attempt, "error", err)
+		p.setBackingOff(true)
+		select {
+		case <-ctx.Done():
+			p.setBackingOff(false)
+			return
+		case <-time.After(delay):
+		}
+		if p.isStopping() {
+			p.setBackingOff(false)
+			return
+		}
+		p.mu.Lock()
+		p.restartCount++
+		p.panicked = false
+		p.backingOff = false
+		p.mu.Unlock()
+	}
+}
+
+// runOnce starts the plugin and waits for it to exit, either by reporting an error or by
+// returning from Start, which is a clean exit. It returns false if ctx was cancelled before
+// the plugin exited.
+func (p *supervisor) runOnce(ctx context.Context) (bool, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		defer utils.Recover(func(err *utils.PanicError) {
+			p.log.Error(err, "plugin panicked", "stack", err.Stack)
+			select {
+			case errCh <- err:
+			case <-runCtx.Done():
+			}
+		})
+		p.plugin.Start(runCtx, errCh)
+	}()
+	var err error
+	select {
+	case <-ctx.Done():
+		return false, nil
+	case err = <-errCh:
+	case <-returned:
+	}
+	if p.isStopping() {
+		return true, err
+	}
+	// release whatever the exited run still holds before starting it again
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), stopTimeout(p.plugin))
+	defer stopCancel()
+	if stopErr := callPlugin(p.name, "Stop", func() error { return p.plugin.Stop(stopCtx) }); stopErr != nil {
+		p.log.Error(stopErr, "failed to stop plugin after it exited")
+	}
+	return true, err
+}
+
+// recordExit records the result of a run and reports whether the plugin should be restarted
+func (p *supervisor) recordExit(err error, ranFor time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ranFor >= backoffResetAfter {
+		p.backoff = 0
+		p.consecutiveFailures = 0
+	}
+	if err != nil {
+		p.lastError = err
+		p.errorCount++
+		p.consecutiveFailures++
+	}
+	var panicErr *utils.PanicError
+	p.panicked = errors.As(err, &panicErr)
+	switch p.policy {
+	case api.RestartPolicyNever:
+		return false
+	case api.RestartPolicyOnFailure:
+		return err != nil
+	default:
+		return true
+	}
+}
+
+// nextBackoff returns the delay before the next restart and the number of that restart
+func (p *supervisor) nextBackoff() (time.Duration, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.backoff == 0 {
+		p.backoff = initialRestartBackoff
+	} else {
+		p.backoff *= 2
+		if p.backoff > maxRestartBackoff {
+			p.backoff = maxRestartBackoff
+		}
+	}
+	return p.backoff, p.restartCount + 1
+}
+
+// stop stops the plugin gracefully and waits for the supervisor loop to exit
+func (p *supervisor) stop(ctx context.Context) error {
+	p.mu.Lock()
+	p.stopping = true
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+
+	err := callPlugin(p.name, "Stop", func() error { return p.plugin.Stop(ctx) })
+	if cancel == nil {
+		return err
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = fmt.Errorf("timeout waiting for supervisor of plugin %s to exit: %w", p.name, ctx.Err())
+		}
+	}
+	return err
+}
+
+func (p *supervisor) setBackingOff(backingOff bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backingOff = backingOff
+}
+
+func (p *supervisor) isStopping() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopping
+}
+
+// isRunning reports whether the supervisor loop is still active
+func (p *supervisor) isRunning() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// annotate returns a copy of status with the restart information of the supervisor. The
+// conditions set by the supervisor override the ones reported by the plugin.
+func (p *supervisor) annotate(status *api.PluginStatus) *api.PluginStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := status.DeepCopy()
+	result.RestartCount = p.restartCount
+	result.ErrorCount += p.errorCount
+	var lastError string
+	if p.lastError != nil {
+		lastError = p.lastError.Error()
+		result.LastError = lastError
+		var panicErr *utils.PanicError
+		if errors.As(p.lastError, &panicErr) {
+			result.PanicStack = panicErr.Stack
+		}
+	}
+	if !p.running {
+		result.Running = false
+		result.SetCondition(api.ConditionReady, metav1.ConditionFalse, api.ReasonStopped, "plugin is not running")
+	}
+	if p.backingOff {
+		result.SetCondition(api.ConditionProgressing, metav1.ConditionTrue, "BackOff",
+			fmt.Sprintf("waiting %s before restarting the plugin", p.backoff))
+	}
+	if p.panicked {
+		result.SetCondition(api.ConditionReady, metav1.ConditionFalse, api.ReasonPanicked, lastError)
+		result.SetCondition(api.ConditionDegraded, metav1.ConditionTrue, api.ReasonPanicked, lastError)
+	}
+	if p.consecutiveFailures >= crashLoopThreshold {
+		message := fmt.Sprintf("plugin failed %d times in a row: %s", p.consecutiveFailures, lastError)
+		result.SetCondition(api.ConditionReady, metav1.ConditionFalse, api.ReasonCrashLoopBackOff, message)
+		result.SetCondition(api.ConditionDegraded, metav1.ConditionTrue, api.ReasonCrashLoopBackOff, message)
+	}
+	return result
+}
+
+// callPlugin calls a plugin method and turns a panic in it into an error
+func callPlugin(name, method string, fn func() error) (err error) {
+	defer utils.Recover(func(panicErr *utils.PanicError) {
+		err = fmt.Errorf("plugin %s panicked in %s: %w", name, method, panicErr)
+	})
+	return fn()
+}
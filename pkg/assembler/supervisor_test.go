@@ -0,0 +1,197 @@
+package assembler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSupervisorRecordExit(t *testing.T) {
+	failure := errors.New("boom")
+	tests := []struct {
+		name        string
+		policy      string
+		err         error
+		wantRestart bool
+	}{
+		{name: "always restarts on failure", policy: api.RestartPolicyAlways, err: failure, wantRestart: true},
+		{name: "always restarts on success", policy: api.RestartPolicyAlways, err: nil, wantRestart: true},
+		{name: "empty policy defaults to always", policy: "", err: nil, wantRestart: true},
+		{name: "on failure restarts on failure", policy: api.RestartPolicyOnFailure, err: failure, wantRestart: true},
+		{name: "on failure does not restart on success", policy: api.RestartPolicyOnFailure, err: nil, wantRestart: false},
+		{name: "never does not restart", policy: api.RestartPolicyNever, err: failure, wantRestart: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newSupervisor("test", nil, tt.policy, logr.Discard())
+			if got := p.recordExit(tt.err, time.Second); got != tt.wantRestart {
+				t.Errorf("recordExit() = %v, want %v", got, tt.wantRestart)
+			}
+			if tt.err != nil && p.lastError != tt.err {
+				t.Errorf("recordExit() lastError = %v, want %v", p.lastError, tt.err)
+			}
+		})
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	p := newSupervisor("test", nil, api.RestartPolicyAlways, logr.Discard())
+	var delays []time.Duration
+	for i := 0; i < 12; i++ {
+		p.recordExit(errors.New("boom"), time.Second)
+		delay, _ := p.nextBackoff()
+		delays = append(delays, delay)
+	}
+	if delays[0] != initialRestartBackoff || delays[1] != 2*initialRestartBackoff {
+		t.Errorf("nextBackoff() = %v, want exponential backoff starting at %v", delays[:2], initialRestartBackoff)
+	}
+	if delays[len(delays)-1] != maxRestartBackoff {
+		t.Errorf("nextBackoff() = %v, want capped at %v", delays[len(delays)-1], maxRestartBackoff)
+	}
+	status := p.annotate(readyStatus())
+	if reason := status.GetCondition(api.ConditionReady).Reason; reason != api.ReasonCrashLoopBackOff {
+		t.Errorf("annotate() ready reason = %v, want %v", reason, api.ReasonCrashLoopBackOff)
+	}
+	if status.ErrorCount != 12 {
+		t.Errorf("annotate() errorCount = %d, want 12", status.ErrorCount)
+	}
+
+	// a long successful run resets the backoff
+	p.recordExit(errors.New("boom"), backoffResetAfter)
+	if delay, _ := p.nextBackoff(); delay != initialRestartBackoff {
+		t.Errorf("nextBackoff() after long run = %v, want %v", delay, initialRestartBackoff)
+	}
+}
+
+// panicPlugin panics in Start until it has been started panics+1 times
+type panicPlugin struct {
+	mu      sync.Mutex
+	starts  int
+	panics  int
+	running bool
+}
+
+func (p *panicPlugin) Name() string                               { return "panic" }
+func (p *panicPlugin) Init(interface{}, api.SidecarManager) error { return nil }
+func (p *panicPlugin) Version() string                            { return "v0.0.1" }
+func (p *panicPlugin) GetConfigType() interface{}                 { return &struct{}{} }
+func (p *panicPlugin) Stop(context.Context) error                 { return nil }
+func (p *panicPlugin) Status() (*api.PluginStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := &api.PluginStatus{Name: "panic", Running: p.running}
+	status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "Running", "")
+	return status, nil
+}
+
+func readyStatus() *api.PluginStatus {
+	status := &api.PluginStatus{Running: true}
+	status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "Running", "")
+	return status
+}
+
+func (p *panicPlugin) Start(ctx context.Context, errCh chan<- error) {
+	p.mu.Lock()
+	p.starts++
+	if p.starts <= p.panics {
+		p.mu.Unlock()
+		var m map[string]int
+		m["boom"]++
+	}
+	p.running = true
+	p.mu.Unlock()
+	<-ctx.Done()
+}
+
+func TestSupervisorRecoversPanic(t *testing.T) {
+	plugin := &panicPlugin{panics: 1}
+	p := newSupervisor("panic", plugin, api.RestartPolicyAlways, logr.Discard())
+	// a panic is recorded and the plugin is unhealthy until it is restarted
+	p.recordExit(&utils.PanicError{Value: "boom", Stack: "stack"}, time.Second)
+	if !p.panicked {
+		t.Fatalf("recordExit() of a panic should mark the plugin panicked")
+	}
+	status := p.annotate(readyStatus())
+	if status.IsReady() || status.GetCondition(api.ConditionDegraded).Reason != api.ReasonPanicked || status.PanicStack != "stack" {
+		t.Errorf("annotate() = %+v, want degraded by the panic with its stack", status)
+	}
+
+	p = newSupervisor("panic", plugin, api.RestartPolicyAlways, logr.Discard())
+	p.start(context.Background())
+	defer p.stop(context.Background())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, _ := plugin.Status()
+		status = p.annotate(status)
+		if status.Running && status.RestartCount == 1 {
+			if status.PanicStack == "" {
+				t.Errorf("annotate() should keep the stack of the last panic")
+			}
+			if !status.IsReady() {
+				t.Errorf("annotate() = %+v after restart, want ready", status.Conditions)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin was not restarted after panic, status %+v", status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// returningPlugin returns from Start right away without reporting anything
+type returningPlugin struct {
+	panicPlugin
+}
+
+func (p *returningPlugin) Start(context.Context, chan<- error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts++
+}
+
+func (p *returningPlugin) startCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.starts
+}
+
+func TestSupervisorRestartsReturnedPlugin(t *testing.T) {
+	plugin := &returningPlugin{}
+	p := newSupervisor("returning", plugin, api.RestartPolicyAlways, logr.Discard())
+	p.start(context.Background())
+	defer p.stop(context.Background())
+	// 第一次重启前等待 initialRestartBackoff
+	deadline := time.Now().Add(initialRestartBackoff + 5*time.Second)
+	for plugin.startCount() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin was started %d times, want it restarted after Start returned", plugin.startCount())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	status := p.annotate(readyStatus())
+	if status.RestartCount < 1 || status.ErrorCount != 0 {
+		t.Errorf("annotate() restartCount = %d, errorCount = %d, want a restart without errors", status.RestartCount, status.ErrorCount)
+	}
+
+	// OnFailure 不重启正常退出的插件
+	plugin = &returningPlugin{}
+	p = newSupervisor("returning", plugin, api.RestartPolicyOnFailure, logr.Discard())
+	p.start(context.Background())
+	defer p.stop(context.Background())
+	for deadline := time.Now().Add(5 * time.Second); p.isRunning(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("supervisor is still running after the plugin exited cleanly")
+		}
+	}
+	if got := plugin.startCount(); got != 1 {
+		t.Errorf("plugin was started %d times, want 1", got)
+	}
+}
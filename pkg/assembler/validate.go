@@ -0,0 +1,139 @@
+package assembler
+
+import (
+	"sort"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/injector"
+	"github.com/magicsong/kidecar/pkg/plugins"
+	"github.com/magicsong/kidecar/pkg/utils"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var supportedRestartPolicies = []string{api.RestartPolicyAlways, api.RestartPolicyOnFailure, api.RestartPolicyNever}
+
+// ValidateConfig checks config offline the way the sidecar checks it when loading it. The config
+// of every plugin is decoded strictly, so unknown fields are reported too. Every error carries
+// the path of the invalid field below fldPath.
+func ValidateConfig(config *api.SidecarConfig, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if config.RestartPolicy != "" && validateRestartPolicy(config.RestartPolicy) != nil {
+		errs = append(errs, field.NotSupported(fldPath.Child("restartPolicy"), config.RestartPolicy, supportedRestartPolicies))
+	}
+	if config.StageTimeoutSeconds < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("stageTimeoutSeconds"), config.StageTimeoutSeconds, "must not be negative"))
+	}
+	errs = append(errs, validateListeners(config, fldPath)...)
+
+	pluginsPath := fldPath.Child("plugins")
+	names := sets.New[string]()
+	for i, p := range config.Plugins {
+		errs = append(errs, validatePlugin(p, names, pluginsPath.Index(i))...)
+		names.Insert(p.Name)
+	}
+	for i, p := range config.Plugins {
+		for j, dep := range p.DependsOn {
+			if !names.Has(dep) {
+				errs = append(errs, field.NotFound(pluginsPath.Index(i).Child("dependsOn").Index(j), dep))
+			}
+		}
+	}
+	// 依赖环等问题只在插件本身都合法时检查，避免重复报告同一个错误
+	if len(errs) == 0 {
+		if _, err := buildBootStages(config.Plugins); err != nil {
+			errs = append(errs, field.Invalid(pluginsPath, field.OmitValueType{}, err.Error()))
+		}
+	}
+	return errs
+}
+
+func validateListeners(config *api.SidecarConfig, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	names := sets.New[string]()
+	for _, l := range listeners(&api.SidecarConfig{}) {
+		names.Insert(l.Name)
+	}
+	configured := sets.New[string]()
+	for i, l := range config.Listeners {
+		path := fldPath.Child("listeners").Index(i)
+		if l.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		} else if configured.Has(l.Name) {
+			errs = append(errs, field.Duplicate(path.Child("name"), l.Name))
+		}
+		if l.Address == "" {
+			errs = append(errs, field.Required(path.Child("address"), ""))
+		} else if l.Name == api.DefaultListener {
+			// 默认监听器提供 kidecar 容器的探针，必须能从 pod 外访问
+			if _, err := injector.ListenerPort(l.Address); err != nil {
+				errs = append(errs, field.Invalid(path.Child("address"), l.Address, "the default listener serves the kidecar probes: "+err.Error()))
+			}
+		}
+		configured.Insert(l.Name)
+		names.Insert(l.Name)
+	}
+	if listener := config.AdminServer.Listener; listener != "" && !names.Has(listener) {
+		errs = append(errs, field.NotFound(fldPath.Child("adminServer", "listener"), listener))
+	}
+	return errs
+}
+
+func validatePlugin(p api.PluginConfig, names sets.Set[string], fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if p.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("name"), ""))
+	} else if names.Has(p.Name) {
+		errs = append(errs, field.Duplicate(fldPath.Child("name"), p.Name))
+	}
+	if p.RestartPolicy != "" && validateRestartPolicy(p.RestartPolicy) != nil {
+		errs = append(errs, field.NotSupported(fldPath.Child("restartPolicy"), p.RestartPolicy, supportedRestartPolicies))
+	}
+	pluginType := p.PluginType()
+	if _, ok := plugins.PluginRegistry[pluginType]; !ok {
+		typePath := fldPath.Child("type")
+		if p.Type == "" {
+			// 未指定类型时使用名称作为类型
+			typePath = fldPath.Child("name")
+		}
+		return append(errs, field.NotSupported(typePath, pluginType, sortedPluginTypes()))
+	}
+	configPath := pluginConfigPath(p, fldPath)
+	if pluginType == api.BinaryPluginType && p.Binary == nil {
+		return append(errs, field.Required(configPath, "binary is required for plugin type "+api.BinaryPluginType))
+	}
+	if _, ok := p.Config.(map[string]interface{}); p.Config != nil && !ok {
+		return append(errs, field.TypeInvalid(configPath, field.OmitValueType{}, "must be an object"))
+	}
+	plugin, pluginConfig, err := decodePluginConfigWith(p, utils.ConvertJsonObjectToStructStrict)
+	if err != nil {
+		return append(errs, field.Invalid(configPath, field.OmitValueType{}, err.Error()))
+	}
+	return append(errs, validatePluginConfig(plugin, pluginConfig, configPath)...)
+}
+
+// pluginConfigPath returns the path of the config of p, which is binary for binary plugins
+func pluginConfigPath(p api.PluginConfig, fldPath *field.Path) *field.Path {
+	if p.PluginType() == api.BinaryPluginType {
+		return fldPath.Child("binary")
+	}
+	return fldPath.Child("config")
+}
+
+// validatePluginConfig validates the decoded config if the plugin implements api.ConfigValidator
+func validatePluginConfig(plugin api.Plugin, config interface{}, fldPath *field.Path) field.ErrorList {
+	validator, ok := plugin.(api.ConfigValidator)
+	if !ok {
+		return nil
+	}
+	return validator.ValidateConfig(config, fldPath)
+}
+
+func sortedPluginTypes() []string {
+	types := make([]string, 0, len(plugins.PluginRegistry))
+	for t := range plugins.PluginRegistry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,93 @@
+package assembler
+
+import (
+	"testing"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateConfig(t *testing.T) {
+	hotUpdate := map[string]interface{}{"loadPatchType": "signal", "signal": map[string]interface{}{"signalName": "SIGHUP"}, "fileDir": "/app"}
+	tests := []struct {
+		name       string
+		config     api.SidecarConfig
+		wantFields []string
+	}{
+		{
+			name: "valid",
+			config: api.SidecarConfig{Plugins: []api.PluginConfig{
+				{Name: "hot_update", BootOrder: 1, Config: hotUpdate},
+				{Name: "proxy", Type: api.BinaryPluginType, BootOrder: 1, DependsOn: []string{"hot_update"}, Binary: &v1alpha1.Binary{Path: "/bin/proxy"}},
+			}},
+		},
+		{
+			name: "unknown type and field",
+			config: api.SidecarConfig{Plugins: []api.PluginConfig{
+				{Name: "foo", BootOrder: 1},
+				{Name: "probe", Type: "http_probe", BootOrder: 1, Config: map[string]interface{}{"probeInterval": 5}},
+			}},
+			wantFields: []string{"spec.plugins[0].name", "spec.plugins[1].config"},
+		},
+		{
+			name: "plugin checks",
+			config: api.SidecarConfig{Plugins: []api.PluginConfig{
+				{Name: "hot_update", BootOrder: 1, Config: map[string]interface{}{"fileDir": "/app"}},
+				{Name: "http_probe", BootOrder: 1, Config: map[string]interface{}{
+					"endpoints": []interface{}{map[string]interface{}{"url": "http://localhost", "storageConfig": map[string]interface{}{"type": "InKube"}}},
+				}},
+			}},
+			wantFields: []string{"spec.plugins[0].config.loadPatchType", "spec.plugins[1].config.endpoints[0].storageConfig"},
+		},
+		{
+			name: "dependencies",
+			config: api.SidecarConfig{Plugins: []api.PluginConfig{
+				{Name: "hot_update", BootOrder: 1, DependsOn: []string{"missing"}, Config: hotUpdate},
+				{Name: "hot_update", BootOrder: 1, Config: hotUpdate},
+			}},
+			wantFields: []string{"spec.plugins[1].name", "spec.plugins[0].dependsOn[0]"},
+		},
+		{
+			name: "cycle",
+			config: api.SidecarConfig{Plugins: []api.PluginConfig{
+				{Name: "a", Type: "hot_update", BootOrder: 1, DependsOn: []string{"b"}, Config: hotUpdate},
+				{Name: "b", Type: "hot_update", BootOrder: 1, DependsOn: []string{"a"}, Config: hotUpdate},
+			}},
+			wantFields: []string{"spec.plugins"},
+		},
+		{
+			name: "unreachable default listener",
+			config: api.SidecarConfig{Listeners: []v1alpha1.ListenerConfig{
+				{Name: api.DefaultListener, Address: "127.0.0.1:9000"},
+				{Name: "metrics", Address: "localhost:9090"},
+				{Name: api.HotUpdateListener, Address: "5000"},
+			}},
+			wantFields: []string{"spec.listeners[0].address"},
+		},
+		{
+			name: "unparsable default listener",
+			config: api.SidecarConfig{Listeners: []v1alpha1.ListenerConfig{
+				{Name: api.DefaultListener, Address: "8080"},
+			}},
+			wantFields: []string{"spec.listeners[0].address"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateConfig(&tt.config, field.NewPath("spec"))
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if len(fields) != len(tt.wantFields) {
+				t.Fatalf("ValidateConfig() = %v, want errors on %v", errs, tt.wantFields)
+			}
+			for i := range fields {
+				if fields[i] != tt.wantFields[i] {
+					t.Errorf("ValidateConfig() error %d on %s, want %s", i, fields[i], tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
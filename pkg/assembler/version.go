@@ -0,0 +1,50 @@
+package assembler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/info"
+	"github.com/magicsong/kidecar/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// annotateVersion writes the build information of the kidecar to the current pod, so the
+// controller can tell which kidecar build each pod runs
+func (s *sidecar) annotateVersion(ctx context.Context) {
+	nsname, err := info.GetCurrentPodNamespaceAndName()
+	if err != nil {
+		s.log.V(1).Info("not running in a pod, skip version annotation", "reason", err.Error())
+		return
+	}
+	if err := s.patchVersionAnnotation(ctx, nsname); err != nil {
+		s.log.Error(err, "failed to annotate pod with kidecar version")
+		return
+	}
+	s.log.Info("pod annotated with kidecar version", "version", version.Version, "annotation", v1alpha1.VersionAnnotation)
+}
+
+func (s *sidecar) patchVersionAnnotation(ctx context.Context, nsname *types.NamespacedName) error {
+	build, err := json.Marshal(version.Get())
+	if err != nil {
+		return fmt.Errorf("failed to marshal version: %w", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				v1alpha1.VersionAnnotation: string(build),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal annotation patch: %w", err)
+	}
+	return retry.OnError(retry.DefaultBackoff, func(error) bool { return ctx.Err() == nil }, func() error {
+		_, err := s.SidecarManager.CoreV1().Pods(nsname.Namespace).Patch(ctx, nsname.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
@@ -0,0 +1,116 @@
+package assembler
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/injector"
+	"github.com/magicsong/kidecar/pkg/plugins"
+	"github.com/magicsong/kidecar/pkg/utils"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// KidecarConfigHooks returns the hooks the SidecarConfig webhooks use to default and validate
+// spec.kidecar the same way the sidecar does when loading it
+func KidecarConfigHooks() v1alpha1.KidecarConfigHooks {
+	return v1alpha1.KidecarConfigHooks{
+		Default:  DefaultKidecarConfig,
+		Validate: ValidateKidecarConfig,
+	}
+}
+
+// ValidateKidecarConfig validates the kidecar config of a SidecarConfig
+func ValidateKidecarConfig(config *v1alpha1.KidecarConfig, fldPath *field.Path) field.ErrorList {
+	sidecarConfig, err := injector.ConvertKubeConfigToSidecarConfig(config)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath.Child("plugins"), field.OmitValueType{}, err.Error())}
+	}
+	return ValidateConfig(sidecarConfig, fldPath)
+}
+
+// DefaultKidecarConfig applies the defaults of every plugin to its config in place. Only the
+// fields changed by defaulting are written back, plugins whose config cannot be decoded are left
+// to the validation.
+func DefaultKidecarConfig(config *v1alpha1.KidecarConfig) error {
+	sidecarConfig, err := injector.ConvertKubeConfigToSidecarConfig(config)
+	if err != nil {
+		return err
+	}
+	for i, p := range sidecarConfig.Plugins {
+		if _, ok := plugins.PluginRegistry[p.PluginType()]; !ok {
+			continue
+		}
+		if p.PluginType() == api.BinaryPluginType && p.Binary == nil {
+			continue
+		}
+		if _, ok := p.Config.(map[string]interface{}); p.Config != nil && !ok {
+			continue
+		}
+		plugin, pluginConfig, err := newPluginConfig(p, utils.ConvertJsonObjectToStruct)
+		if err != nil {
+			continue
+		}
+		if p.PluginType() == api.BinaryPluginType {
+			defaultPluginConfig(plugin, pluginConfig)
+			config.Plugins[i].Binary = pluginConfig.(*v1alpha1.Binary)
+			continue
+		}
+		defaulted, err := defaultConfigFields(plugin, pluginConfig)
+		if err != nil {
+			return fmt.Errorf("failed to default plugin %s: %w", p.Name, err)
+		}
+		if len(defaulted) == 0 {
+			continue
+		}
+		merged, _ := p.Config.(map[string]interface{})
+		if merged == nil {
+			merged = map[string]interface{}{}
+		}
+		for key, value := range defaulted {
+			merged[key] = value
+		}
+		raw, err := json.Marshal(merged)
+		if err != nil {
+			return fmt.Errorf("failed to default plugin %s: %w", p.Name, err)
+		}
+		config.Plugins[i].Config = &runtime.RawExtension{Raw: raw}
+	}
+	return nil
+}
+
+// defaultConfigFields defaults config and returns the top-level fields changed by defaulting
+func defaultConfigFields(plugin api.Plugin, config interface{}) (map[string]interface{}, error) {
+	before, err := toConfigMap(config)
+	if err != nil {
+		return nil, err
+	}
+	defaultPluginConfig(plugin, config)
+	after, err := toConfigMap(config)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]interface{}{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changed[key] = value
+		}
+	}
+	return changed, nil
+}
+
+// toConfigMap converts a decoded plugin config back to its generic form
+func toConfigMap(config interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,33 @@
+package assembler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDefaultKidecarConfig(t *testing.T) {
+	config := &v1alpha1.KidecarConfig{Plugins: []v1alpha1.PluginConfig{
+		{Name: "hot_update", Config: &runtime.RawExtension{Raw: []byte(`{"loadPatchType":"signal","fileDir":"/app","custom":"kept"}`)}},
+		{Name: "listener", Type: "hot_update", Config: &runtime.RawExtension{Raw: []byte(`{"loadPatchType":"signal","fileDir":"/app","listener":"default"}`)}},
+	}}
+	if err := DefaultKidecarConfig(config); err != nil {
+		t.Fatalf("DefaultKidecarConfig() error = %v", err)
+	}
+
+	var defaulted map[string]interface{}
+	if err := json.Unmarshal(config.Plugins[0].Config.Raw, &defaulted); err != nil {
+		t.Fatal(err)
+	}
+	if defaulted["listener"] != "hot-update" || defaulted["custom"] != "kept" {
+		t.Errorf("defaulted config = %v, want listener hot-update and unknown fields kept", defaulted)
+	}
+	if _, ok := defaulted["signal"]; ok {
+		t.Errorf("defaulted config = %v, want only the defaulted fields added", defaulted)
+	}
+	if got := string(config.Plugins[1].Config.Raw); got != `{"loadPatchType":"signal","fileDir":"/app","listener":"default"}` {
+		t.Errorf("config without defaults changed to %s", got)
+	}
+}
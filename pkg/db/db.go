@@ -0,0 +1,228 @@
+// Package db is the local persistent key-value store of the sidecar, backed by a bbolt file
+// on the state volume. Every plugin uses its own bucket, values can expire after a TTL.
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api"
+	bolt "go.etcd.io/bbolt"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// FileName 是状态目录下数据库文件的名称
+	FileName = "kidecar.db"
+	// openTimeout 是获取数据库文件锁的超时时间
+	openTimeout = 5 * time.Second
+	// purgeInterval 是清理过期数据的间隔
+	purgeInterval = time.Minute
+	// expiryHeaderSize 每个值前面保存过期时间（UnixNano，0 表示永不过期）
+	expiryHeaderSize = 8
+)
+
+var _ api.DBManager = &DB{}
+
+// DB implements api.DBManager
+type DB struct {
+	dir  string
+	db   *bolt.DB
+	log  logr.Logger
+	stop chan struct{}
+	once sync.Once
+}
+
+// Open opens or creates the store in dir and starts purging expired values
+func Open(dir string) (*DB, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create state dir %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, FileName)
+	boltDB, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store %s: %w", path, err)
+	}
+	d := &DB{
+		dir:  dir,
+		db:   boltDB,
+		log:  logf.Log.WithName("db"),
+		stop: make(chan struct{}),
+	}
+	go d.purgeLoop()
+	return d, nil
+}
+
+// Bucket implements api.DBManager.
+func (d *DB) Bucket(name string) (api.KVStore, error) {
+	if name == "" {
+		return nil, errors.New("bucket name is empty")
+	}
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(name))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket %s: %w", name, err)
+	}
+	return &bucket{db: d.db, name: []byte(name)}, nil
+}
+
+// Dir implements api.DBManager.
+func (d *DB) Dir(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid dir name %q", name)
+	}
+	dir := filepath.Join(d.dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create dir %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// Close implements api.DBManager.
+func (d *DB) Close() error {
+	var err error
+	d.once.Do(func() {
+		close(d.stop)
+		err = d.db.Close()
+	})
+	return err
+}
+
+func (d *DB) purgeLoop() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			if err := d.purgeExpired(time.Now()); err != nil {
+				d.log.Error(err, "failed to purge expired values")
+			}
+		}
+	}
+}
+
+// purgeExpired deletes the values that expired before now from all buckets
+func (d *DB) purgeExpired(now time.Time) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			var expired [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				if isExpired(v, now) {
+					expired = append(expired, append([]byte{}, k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// bucket implements api.KVStore on one bbolt bucket
+type bucket struct {
+	db   *bolt.DB
+	name []byte
+}
+
+func (b *bucket) Get(key string) ([]byte, bool, error) {
+	var value []byte
+	var found bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		value, found, err = (&txn{bucket: tx.Bucket(b.name)}).Get(key)
+		return err
+	})
+	return value, found, err
+}
+
+func (b *bucket) Put(key string, value []byte, ttl time.Duration) error {
+	return b.Update(func(tx api.KVTxn) error {
+		return tx.Put(key, value, ttl)
+	})
+}
+
+func (b *bucket) Delete(key string) error {
+	return b.Update(func(tx api.KVTxn) error {
+		return tx.Delete(key)
+	})
+}
+
+func (b *bucket) Keys() ([]string, error) {
+	var keys []string
+	now := time.Now()
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.name).ForEach(func(k, v []byte) error {
+			if !isExpired(v, now) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Update runs fn in a single write transaction, none of its writes are applied if fn fails
+func (b *bucket) Update(fn func(tx api.KVTxn) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(&txn{bucket: tx.Bucket(b.name)})
+	})
+}
+
+type txn struct {
+	bucket *bolt.Bucket
+}
+
+func (t *txn) Get(key string) ([]byte, bool, error) {
+	v := t.bucket.Get([]byte(key))
+	if v == nil || isExpired(v, time.Now()) {
+		return nil, false, nil
+	}
+	if len(v) < expiryHeaderSize {
+		return nil, false, fmt.Errorf("corrupted value of key %s", key)
+	}
+	// bbolt 的值只在事务内有效，需要复制
+	return append([]byte{}, v[expiryHeaderSize:]...), true, nil
+}
+
+func (t *txn) Put(key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return errors.New("key is empty")
+	}
+	var expiry int64
+	if ttl > 0 {
+		expiry = time.Now().Add(ttl).UnixNano()
+	}
+	data := make([]byte, expiryHeaderSize+len(value))
+	binary.BigEndian.PutUint64(data, uint64(expiry))
+	copy(data[expiryHeaderSize:], value)
+	return t.bucket.Put([]byte(key), data)
+}
+
+func (t *txn) Delete(key string) error {
+	return t.bucket.Delete([]byte(key))
+}
+
+func isExpired(v []byte, now time.Time) bool {
+	if len(v) < expiryHeaderSize {
+		return false
+	}
+	expiry := int64(binary.BigEndian.Uint64(v))
+	return expiry > 0 && expiry <= now.UnixNano()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBucket(t *testing.T) {
+	d, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer d.Close()
+
+	probe, err := d.Bucket("http_probe")
+	if err != nil {
+		t.Fatalf("Bucket() error = %v", err)
+	}
+	hotUpdate, err := d.Bucket("hot_update")
+	if err != nil {
+		t.Fatalf("Bucket() error = %v", err)
+	}
+	if err := probe.Put("state", []byte("idle"), 0); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if value, ok, err := probe.Get("state"); err != nil || !ok || string(value) != "idle" {
+		t.Errorf("Get() = %q, %v, %v, want idle", value, ok, err)
+	}
+	// buckets are namespaced
+	if _, ok, _ := hotUpdate.Get("state"); ok {
+		t.Errorf("Get() found a key of another bucket")
+	}
+
+	// expired values are not found
+	if err := probe.Put("expired", []byte("x"), time.Nanosecond); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := probe.Get("expired"); ok {
+		t.Errorf("Get() found an expired value")
+	}
+	if keys, _ := probe.Keys(); len(keys) != 1 || keys[0] != "state" {
+		t.Errorf("Keys() = %v, want [state]", keys)
+	}
+	if err := d.purgeExpired(time.Now()); err != nil {
+		t.Fatalf("purgeExpired() error = %v", err)
+	}
+	d.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("http_probe")).Get([]byte("expired")) != nil {
+			t.Errorf("purgeExpired() kept an expired value")
+		}
+		return nil
+	})
+
+	// a failed update applies none of its writes
+	failure := errors.New("boom")
+	err = probe.Update(func(tx api.KVTxn) error {
+		if err := tx.Put("a", []byte("1"), 0); err != nil {
+			return err
+		}
+		if err := tx.Delete("state"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Update() error = %v, want %v", err, failure)
+	}
+	keys, _ := probe.Keys()
+	sort.Strings(keys)
+	if len(keys) != 1 || keys[0] != "state" {
+		t.Errorf("Keys() after failed update = %v, want [state]", keys)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	d, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	b, _ := d.Bucket("hot_update")
+	if err := b.Put("version", []byte("v1.0.1"), time.Hour); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	d.Close()
+
+	d, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open() again error = %v", err)
+	}
+	defer d.Close()
+	b, _ = d.Bucket("hot_update")
+	if value, ok, _ := b.Get("version"); !ok || string(value) != "v1.0.1" {
+		t.Errorf("Get() after reopen = %q, %v, want v1.0.1", value, ok)
+	}
+}
+
+func TestDir(t *testing.T) {
+	d, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer d.Close()
+	dir, err := d.Dir("binary-cache")
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("Dir() = %s, stat = %v, %v, want a directory", dir, info, err)
+	}
+	for _, name := range []string{"", "..", "a/b"} {
+		if _, err := d.Dir(name); err == nil {
+			t.Errorf("Dir(%q) should fail", name)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/magicsong/kidecar/api"
 	"github.com/magicsong/kidecar/api/v1alpha1"
 	"github.com/magicsong/kidecar/pkg/utils"
-	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,14 +16,19 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
 )
 
-func convertKubeConfigToSidecarConfig(config *v1alpha1.KidecarConfig) (*api.SidecarConfig, error) {
+// ConvertKubeConfigToSidecarConfig converts the kidecar config of a SidecarConfig to the config file of the sidecar
+func ConvertKubeConfigToSidecarConfig(config *v1alpha1.KidecarConfig) (*api.SidecarConfig, error) {
 	result := &api.SidecarConfig{
-		Plugins:           []api.PluginConfig{},
-		RestartPolicy:     config.RestartPolicy,
-		Resources:         config.Resources,
-		SidecarStartOrder: config.SidecarStartOrder,
+		Plugins:             []api.PluginConfig{},
+		RestartPolicy:       config.RestartPolicy,
+		Resources:           config.Resources,
+		SidecarStartOrder:   config.SidecarStartOrder,
+		StageTimeoutSeconds: config.StageTimeoutSeconds,
+		AdminServer:         config.AdminServer,
+		Listeners:           config.Listeners,
 	}
 	for _, plugin := range config.Plugins {
 		convertMap, err := convertRawToMap(plugin.Config)
@@ -32,10 +36,13 @@ func convertKubeConfigToSidecarConfig(config *v1alpha1.KidecarConfig) (*api.Side
 			return nil, fmt.Errorf("failed to convert raw extension to map: %v", err)
 		}
 		result.Plugins = append(result.Plugins, api.PluginConfig{
-			Name:      plugin.Name,
-			Config:    convertMap,
-			BootOrder: plugin.BootOrder,
-			Binary:    plugin.Binary,
+			Name:          plugin.Name,
+			Type:          plugin.Type,
+			Config:        convertMap,
+			BootOrder:     plugin.BootOrder,
+			DependsOn:     plugin.DependsOn,
+			RestartPolicy: plugin.RestartPolicy,
+			Binary:        plugin.Binary,
 		})
 	}
 	return result, nil
@@ -54,7 +61,7 @@ func convertRawToMap(raw *runtime.RawExtension) (map[string]interface{}, error)
 }
 
 func buildConfigYaml(kidecarConfig *v1alpha1.KidecarConfig) (string, error) {
-	apiConfig, err := convertKubeConfigToSidecarConfig(kidecarConfig)
+	apiConfig, err := ConvertKubeConfigToSidecarConfig(kidecarConfig)
 	if err != nil {
 		return "", fmt.Errorf("failed to convert kube config to sidecar config: %v", err)
 	}
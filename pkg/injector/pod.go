@@ -2,15 +2,21 @@ package injector
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 
+	"github.com/magicsong/kidecar/api"
 	"github.com/magicsong/kidecar/api/v1alpha1"
 	"github.com/magicsong/kidecar/pkg/utils"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -20,7 +26,10 @@ const (
 	InjectAnnotationKey  = "sidecarconfig.kidecar.io/inject"
 	ConfigmapHashKey     = "sidecarconfig.kidecar.io/hash"
 	KidecarConfigmapName = "kidecar-config"
-	HotUpdateVolume      = "share-data"
+	// KidecarStateVolume 是 kidecar 本地状态存储的卷，挂载到 --state-dir 的默认目录
+	KidecarStateVolume    = "kidecar-state"
+	KidecarStateMountPath = "/var/lib/kidecar"
+	HotUpdateVolume       = "share-data"
 )
 
 const (
@@ -28,6 +37,13 @@ const (
 	DefaultKidecarImage string = "113745426946.dkr.ecr.us-east-1.amazonaws.com/xuetaotest/kidecar:v5"
 
 	serviceAccountTokenMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// kidecarHTTPPortName 是 sidecar 默认监听器的端口名，/livez 和 /readyz 在该端口上
+	kidecarHTTPPortName = "kidecar-http"
+	// hotUpdatePortName 是 hot-update 监听器的端口名
+	hotUpdatePortName = "hot-update-port"
+	// hotUpdatePluginType 是 hot_update 插件注册的类型名
+	hotUpdatePluginType = "hot_update"
 )
 
 func GetSidecarConfigOfPod(ctx context.Context, pod *corev1.Pod, ctrlclient client.Client) (*v1alpha1.SidecarConfig, error) {
@@ -115,7 +131,13 @@ func InjectPod(ctx context.Context, pod *corev1.Pod, ctrlclient client.Client) e
 		return err
 	}
 	if config.Spec.Injection.InjectKidecar {
-		addKidecarContainer(pod, config)
+		if err := addKidecarContainer(pod, config); err != nil {
+			log.Error(err, "failed to inject kidecar container")
+			return err
+		}
+		if config.Spec.Injection.ReadinessGate {
+			addReadinessGate(pod, v1alpha1.PluginsReadyConditionType)
+		}
 		log.Info("inject kidecar container")
 		defer log.Info("inject kidecar container DONE")
 		if err := EnsureConfigmap(ctx, ctrlclient, pod.Namespace, config); err != nil {
@@ -216,6 +238,15 @@ func addVolumeMounts(pod *corev1.Pod, volumeMounts []corev1.VolumeMount) {
 	}
 }
 
+func addReadinessGate(pod *corev1.Pod, conditionType corev1.PodConditionType) {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == conditionType {
+			return
+		}
+	}
+	pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: conditionType})
+}
+
 func addAnnotations(pod *corev1.Pod, annotations map[string]string) {
 	if pod.Annotations == nil {
 		pod.Annotations = make(map[string]string)
@@ -234,7 +265,108 @@ func getKidecarImage() string {
 	return image
 }
 
-func addKidecarContainer(pod *corev1.Pod, SidecarConfig *v1alpha1.SidecarConfig) {
+// kidecarPorts returns the container ports of the listeners the sidecar serves: the default
+// listener, which always serves the health checks, and the listeners of the hot_update plugins.
+// The probes of the kidecar container target the default listener, so it must be reachable.
+func kidecarPorts(config *v1alpha1.KidecarConfig) ([]corev1.ContainerPort, error) {
+	httpPort, err := ListenerPort(listenerAddress(config, api.DefaultListener))
+	if err != nil {
+		return nil, fmt.Errorf("invalid address of listener %s, which serves the kidecar probes: %w", api.DefaultListener, err)
+	}
+	ports := []corev1.ContainerPort{{Name: kidecarHTTPPortName, ContainerPort: httpPort}}
+	seen := sets.New(httpPort)
+	for _, listener := range hotUpdateListeners(config) {
+		port, ok := listenerPort(config, listener)
+		if !ok || seen.Has(port) {
+			continue
+		}
+		seen.Insert(port)
+		containerPort := corev1.ContainerPort{ContainerPort: port}
+		if listener == api.HotUpdateListener {
+			containerPort.Name = hotUpdatePortName
+		}
+		ports = append(ports, containerPort)
+	}
+	return ports, nil
+}
+
+// hotUpdateListeners returns the listeners the hot_update plugins register their handler on
+func hotUpdateListeners(config *v1alpha1.KidecarConfig) []string {
+	var result []string
+	for _, p := range config.Plugins {
+		if (api.PluginConfig{Name: p.Name, Type: p.Type, Binary: p.Binary}).PluginType() != hotUpdatePluginType {
+			continue
+		}
+		pluginConfig := struct {
+			Listener string `json:"listener"`
+		}{Listener: api.HotUpdateListener}
+		if p.Config != nil && len(p.Config.Raw) > 0 {
+			if err := json.Unmarshal(p.Config.Raw, &pluginConfig); err != nil {
+				continue
+			}
+		}
+		result = append(result, pluginConfig.Listener)
+	}
+	return result
+}
+
+// listenerPort returns the port of the named listener of the sidecar, listeners bound to the
+// loopback address are not reachable from outside the pod and have no port
+func listenerPort(config *v1alpha1.KidecarConfig, name string) (int32, bool) {
+	port, err := ListenerPort(listenerAddress(config, name))
+	return port, err == nil
+}
+
+// listenerAddress returns the address of the named listener of the sidecar, empty if there is none
+func listenerAddress(config *v1alpha1.KidecarConfig, name string) string {
+	addresses := map[string]string{
+		api.DefaultListener:   api.DefaultListenerAddress,
+		api.AdminListener:     api.AdminListenerAddress,
+		api.HotUpdateListener: api.HotUpdateListenerAddress,
+	}
+	for _, l := range config.Listeners {
+		addresses[l.Name] = l.Address
+	}
+	return addresses[name]
+}
+
+// ListenerPort returns the port of a listener address that is reachable from outside the pod,
+// e.g. by the kubelet probes. Addresses on the loopback interface are rejected.
+func ListenerPort(address string) (int32, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0, err
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return 0, fmt.Errorf("%s is a loopback address, which is not reachable from outside the pod", host)
+	}
+	p, err := strconv.ParseInt(port, 10, 32)
+	if err != nil || p <= 0 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %q", port)
+	}
+	return int32(p), nil
+}
+
+// kidecarProbe returns a probe on the health endpoint path of the kidecar container
+func kidecarProbe(path string, periodSeconds, failureThreshold int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString(kidecarHTTPPortName),
+			},
+		},
+		PeriodSeconds:    periodSeconds,
+		FailureThreshold: failureThreshold,
+		TimeoutSeconds:   3,
+	}
+}
+
+func addKidecarContainer(pod *corev1.Pod, SidecarConfig *v1alpha1.SidecarConfig) error {
+	ports, err := kidecarPorts(&SidecarConfig.Spec.Kidecar)
+	if err != nil {
+		return err
+	}
 	kContainer := corev1.Container{
 		Name:  "kidecar",
 		Image: getKidecarImage(),
@@ -263,17 +395,19 @@ func addKidecarContainer(pod *corev1.Pod, SidecarConfig *v1alpha1.SidecarConfig)
 				Value: "nginx: master process nginx",
 			},
 		},
-		Ports: []corev1.ContainerPort{
-			{
-				Name:          "hot-update-port",
-				ContainerPort: 5000,
-			},
-		},
+		Ports:          ports,
+		StartupProbe:   kidecarProbe("/livez", 2, 60),
+		LivenessProbe:  kidecarProbe("/livez", 10, 3),
+		ReadinessProbe: kidecarProbe("/readyz", 5, 1),
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      KidecarConfigmapName,
 				MountPath: "/opt/kidecar",
 			},
+			{
+				Name:      KidecarStateVolume,
+				MountPath: KidecarStateMountPath,
+			},
 		},
 	}
 	if SidecarConfig.Spec.Injection.UseKubeNativeSidecar {
@@ -296,5 +430,24 @@ func addKidecarContainer(pod *corev1.Pod, SidecarConfig *v1alpha1.SidecarConfig)
 				},
 			},
 		},
-	})
+	}, stateVolume(&SidecarConfig.Spec.Injection.StateVolume))
+	return nil
+}
+
+// stateVolume returns the volume of the kidecar local state store
+func stateVolume(config *v1alpha1.StateVolumeConfig) corev1.Volume {
+	volume := corev1.Volume{
+		Name: KidecarStateVolume,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	if config.ClaimName != "" {
+		volume.VolumeSource = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: config.ClaimName,
+			},
+		}
+	}
+	return volume
 }
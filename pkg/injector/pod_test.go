@@ -0,0 +1,51 @@
+package injector
+
+import (
+	"testing"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestAddKidecarContainer(t *testing.T) {
+	tests := []struct {
+		name      string
+		listeners []v1alpha1.ListenerConfig
+		wantPort  int32
+		wantErr   bool
+	}{
+		{name: "default address", wantPort: 8080},
+		{name: "configured port", listeners: []v1alpha1.ListenerConfig{{Name: api.DefaultListener, Address: ":9000"}}, wantPort: 9000},
+		{name: "loopback address", listeners: []v1alpha1.ListenerConfig{{Name: api.DefaultListener, Address: "127.0.0.1:9000"}}, wantErr: true},
+		{name: "localhost", listeners: []v1alpha1.ListenerConfig{{Name: api.DefaultListener, Address: "localhost:9000"}}, wantErr: true},
+		{name: "unparsable address", listeners: []v1alpha1.ListenerConfig{{Name: api.DefaultListener, Address: "9000"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1alpha1.SidecarConfig{}
+			config.Spec.Kidecar.Listeners = tt.listeners
+			pod := &corev1.Pod{}
+			err := addKidecarContainer(pod, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addKidecarContainer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(pod.Spec.Containers) != 0 {
+					t.Errorf("kidecar container was injected with an unreachable default listener")
+				}
+				return
+			}
+			kidecar := pod.Spec.Containers[0]
+			if len(kidecar.Ports) == 0 || kidecar.Ports[0].Name != kidecarHTTPPortName || kidecar.Ports[0].ContainerPort != tt.wantPort {
+				t.Errorf("ports = %+v, want %s on %d", kidecar.Ports, kidecarHTTPPortName, tt.wantPort)
+			}
+			for _, probe := range []*corev1.Probe{kidecar.StartupProbe, kidecar.LivenessProbe, kidecar.ReadinessProbe} {
+				if probe.HTTPGet.Port != intstr.FromString(kidecarHTTPPortName) {
+					t.Errorf("probe port = %v, want %s", probe.HTTPGet.Port, kidecarHTTPPortName)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// httpServers owns every HTTP listener of the sidecar. Plugins and storages register
+// handlers on a named listener instead of binding ports or using http.DefaultServeMux.
+type httpServers struct {
+	log logr.Logger
+
+	mu        sync.Mutex
+	listeners map[string]*httpListener
+	started   bool
+}
+
+type httpListener struct {
+	name    string
+	address string
+	mux     *http.ServeMux
+	server  *http.Server
+	serving bool
+
+	mu       sync.RWMutex
+	handlers map[string]http.Handler
+	// routes 是已经注册到 mux 的 pattern，http.ServeMux 不支持删除路由，注销后路由仍然保留
+	routes map[string]bool
+}
+
+func newHTTPServers() *httpServers {
+	return &httpServers{
+		log:       logf.Log.WithName("http-server"),
+		listeners: make(map[string]*httpListener),
+	}
+}
+
+// AddListener implements api.HTTPServerManager.
+func (s *httpServers) AddListener(name, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("cannot add listener %s after the http servers are started", name)
+	}
+	if l, ok := s.listeners[name]; ok {
+		l.address = address
+		return nil
+	}
+	mux := http.NewServeMux()
+	s.listeners[name] = &httpListener{
+		name:     name,
+		address:  address,
+		mux:      mux,
+		server:   &http.Server{Handler: mux},
+		handlers: make(map[string]http.Handler),
+		routes:   make(map[string]bool),
+	}
+	return nil
+}
+
+// RegisterHandler implements api.HTTPServerManager.
+// Registering a pattern again replaces the previous handler, so a plugin that is
+// initialized again after a config reload can register its routes again. A listener
+// is only served once it has a handler.
+func (s *httpServers) RegisterHandler(listener, pattern string, handler http.Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.listeners[listener]
+	if !ok {
+		return fmt.Errorf("listener %s not found", listener)
+	}
+	l.mu.Lock()
+	if !l.routes[pattern] {
+		if err := handle(l.mux, pattern, l.handler(pattern)); err != nil {
+			l.mu.Unlock()
+			return fmt.Errorf("failed to register %s on listener %s: %w", pattern, listener, err)
+		}
+		l.routes[pattern] = true
+	}
+	l.handlers[pattern] = handler
+	l.mu.Unlock()
+	if s.started && !l.serving {
+		return s.serve(l)
+	}
+	return nil
+}
+
+// UnregisterHandler implements api.HTTPServerManager.
+// The listener keeps serving its other handlers, and the pattern can be registered again.
+func (s *httpServers) UnregisterHandler(listener, pattern string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.listeners[listener]
+	if !ok {
+		return fmt.Errorf("listener %s not found", listener)
+	}
+	l.mu.Lock()
+	delete(l.handlers, pattern)
+	l.mu.Unlock()
+	return nil
+}
+
+// handle registers handler on mux, turning the panic of an invalid or conflicting pattern into an error
+func handle(mux *http.ServeMux, pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+func (l *httpListener) handler(pattern string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.RLock()
+		handler, ok := l.handlers[pattern]
+		l.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// StartHTTPServers implements api.HTTPServerManager.
+func (s *httpServers) StartHTTPServers() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return nil
+	}
+	s.started = true
+	names := make([]string, 0, len(s.listeners))
+	for name := range s.listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l := s.listeners[name]
+		if len(l.handlers) == 0 {
+			s.log.V(1).Info("no handler registered, skip listener", "listener", name)
+			continue
+		}
+		if err := s.serve(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serve binds the listener and serves it in the background, caller must hold the lock
+func (s *httpServers) serve(l *httpListener) error {
+	ln, err := net.Listen("tcp", l.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s for listener %s: %w", l.address, l.name, err)
+	}
+	l.serving = true
+	go func() {
+		if err := l.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error(err, "http server exited", "listener", l.name, "address", l.address)
+		}
+	}()
+	s.log.Info("http server started", "listener", l.name, "address", l.address)
+	return nil
+}
+
+// ShutdownHTTPServers implements api.HTTPServerManager.
+func (s *httpServers) ShutdownHTTPServers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return nil
+	}
+	var errs []error
+	for name, l := range s.listeners {
+		if !l.serving {
+			continue
+		}
+		if err := l.server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shutdown listener %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterHandler(t *testing.T) {
+	s := newHTTPServers()
+	if err := s.AddListener("default", ":0"); err != nil {
+		t.Fatalf("AddListener() error = %v", err)
+	}
+	if err := s.RegisterHandler("unknown", "/metrics", http.NotFoundHandler()); err == nil {
+		t.Errorf("RegisterHandler() on unknown listener should fail")
+	}
+	if err := s.RegisterHandler("default", "GET", http.NotFoundHandler()); err == nil {
+		t.Errorf("RegisterHandler() with invalid pattern should fail")
+	}
+
+	reply := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		})
+	}
+	if err := s.RegisterHandler("default", "/hot-update", reply("first")); err != nil {
+		t.Fatalf("RegisterHandler() error = %v", err)
+	}
+	// registering the same pattern again replaces the handler
+	if err := s.RegisterHandler("default", "/hot-update", reply("second")); err != nil {
+		t.Fatalf("RegisterHandler() again error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.listeners["default"].mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hot-update", nil))
+	if got := rec.Body.String(); got != "second" {
+		t.Errorf("handler replied %q, want %q", got, "second")
+	}
+
+	// an unregistered pattern returns 404 until it is registered again
+	if err := s.UnregisterHandler("unknown", "/hot-update"); err == nil {
+		t.Errorf("UnregisterHandler() on unknown listener should fail")
+	}
+	if err := s.UnregisterHandler("default", "/hot-update"); err != nil {
+		t.Fatalf("UnregisterHandler() error = %v", err)
+	}
+	rec = httptest.NewRecorder()
+	s.listeners["default"].mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hot-update", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status after unregister = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if err := s.RegisterHandler("default", "/hot-update", reply("third")); err != nil {
+		t.Fatalf("RegisterHandler() after unregister error = %v", err)
+	}
+	rec = httptest.NewRecorder()
+	s.listeners["default"].mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hot-update", nil))
+	if got := rec.Body.String(); got != "third" {
+		t.Errorf("handler replied %q, want %q", got, "third")
+	}
+}
@@ -1,22 +1,43 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/db"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
+var _ api.HTTPServerManager = &httpServers{}
+
 type sidecarManager struct {
 	ctrl.Manager
 	api.DBManager
+	*httpServers
 	kubernetes.Interface
 }
 
-func NewManager() (api.SidecarManager, error) {
+// Options 是创建 sidecar manager 的参数
+type Options struct {
+	// StateDir 是本地状态存储的目录，为空时不启用本地状态存储
+	StateDir string
+	// Standalone 为 true 时不连接 kubernetes 集群，见 NewStandaloneManager
+	Standalone bool
+	// PodManifest 是离线模式下当前 pod 的 manifest 文件，支持 YAML 和 JSON
+	PodManifest string
+	// PatchFile 是离线模式下 InKube 存储写入 patch 的本地 JSON 文件
+	PatchFile string
+}
+
+func NewManager(options Options) (api.SidecarManager, error) {
+	if options.Standalone {
+		return NewStandaloneManager(options)
+	}
 	cfg, err := config.GetConfig()
 	if err != nil {
 		return nil, fmt.Errorf("unable to get kubeconfig: %w", err)
@@ -30,5 +51,36 @@ func NewManager() (api.SidecarManager, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to create kubernetes client: %w", err)
 	}
-	return sidecarManager{Manager: mgr, Interface: kube}, nil
+	return sidecarManager{Manager: mgr, DBManager: openStateStore(options.StateDir), Interface: kube, httpServers: newHTTPServers()}, nil
+}
+
+// openStateStore opens the state store in dir. The local state is an optimization, so a store
+// that cannot be opened is logged and disabled instead of failing the sidecar.
+func openStateStore(dir string) api.DBManager {
+	if dir == "" {
+		return disabledDB{reason: "no state dir is configured"}
+	}
+	store, err := db.Open(dir)
+	if err != nil {
+		logf.Log.WithName("state-store").Error(err, "unable to open state store, local state is disabled", "dir", dir)
+		return disabledDB{reason: fmt.Sprintf("unable to open state store in %s: %v", dir, err)}
+	}
+	return store
+}
+
+// disabledDB is used when no state dir is configured or the state store cannot be opened
+type disabledDB struct {
+	reason string
+}
+
+func (d disabledDB) Bucket(name string) (api.KVStore, error) {
+	return nil, errors.New("state store is disabled, " + d.reason)
+}
+
+func (d disabledDB) Dir(name string) (string, error) {
+	return "", errors.New("state store is disabled, " + d.reason)
+}
+
+func (disabledDB) Close() error {
+	return nil
 }
@@ -0,0 +1,29 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenStateStore(t *testing.T) {
+	// 状态目录是一个普通文件，无法打开状态存储
+	file := filepath.Join(t.TempDir(), "state")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := openStateStore(file)
+	defer store.Close()
+	if _, ok := store.(disabledDB); !ok {
+		t.Fatalf("openStateStore() = %T, want disabledDB", store)
+	}
+	if _, err := store.Bucket("hot_update"); err == nil {
+		t.Error("Bucket() of a disabled store should fail")
+	}
+
+	store = openStateStore(t.TempDir())
+	defer store.Close()
+	if _, err := store.Bucket("hot_update"); err != nil {
+		t.Errorf("Bucket() error = %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/magicsong/kidecar/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// standaloneHost 是离线模式下的 API server 地址，不会被真正访问
+	standaloneHost = "http://127.0.0.1:0"
+	// DefaultPatchFile 是离线模式下默认的 patch 记录文件
+	DefaultPatchFile = "kidecar-patches.json"
+)
+
+var _ api.StandaloneManager = standaloneManager{}
+
+// standaloneManager serves the kubernetes API from fake clients instead of a cluster
+type standaloneManager struct {
+	sidecarManager
+	patchFile string
+}
+
+// PatchFile implements api.StandaloneManager.
+func (m standaloneManager) PatchFile() string {
+	return m.patchFile
+}
+
+// NewStandaloneManager creates a SidecarManager that needs no cluster, so kidecar and its plugins
+// can run on a laptop. Both the clientset and the controller-runtime client are fakes seeded with
+// the pod in options.PodManifest, and POD_NAME/POD_NAMESPACE are set to that pod.
+func NewStandaloneManager(options Options) (api.SidecarManager, error) {
+	pod, err := loadPodManifest(options.PodManifest)
+	if err != nil {
+		return nil, err
+	}
+	// info.GetCurrentPod 通过环境变量找到当前 pod
+	if err := os.Setenv("POD_NAMESPACE", pod.Namespace); err != nil {
+		return nil, err
+	}
+	if err := os.Setenv("POD_NAME", pod.Name); err != nil {
+		return nil, err
+	}
+
+	mgr, err := manager.New(&rest.Config{Host: standaloneHost}, manager.Options{
+		Scheme:  scheme.Scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		NewClient: func(*rest.Config, client.Options) (client.Client, error) {
+			return clientfake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pod.DeepCopy()).Build(), nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create manager: %w", err)
+	}
+	patchFile := options.PatchFile
+	if patchFile == "" {
+		patchFile = DefaultPatchFile
+	}
+	return standaloneManager{
+		sidecarManager: sidecarManager{Manager: mgr, DBManager: openStateStore(options.StateDir), Interface: fake.NewSimpleClientset(pod), httpServers: newHTTPServers()},
+		patchFile:      patchFile,
+	}, nil
+}
+
+// loadPodManifest reads the pod the sidecar pretends to run in
+func loadPodManifest(path string) (*corev1.Pod, error) {
+	if path == "" {
+		return nil, fmt.Errorf("pod manifest is required in standalone mode")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pod manifest %s: %w", path, err)
+	}
+	pod := &corev1.Pod{}
+	if err := yaml.Unmarshal(data, pod); err != nil {
+		return nil, fmt.Errorf("failed to parse pod manifest %s: %w", path, err)
+	}
+	if pod.Kind != "" && pod.Kind != "Pod" {
+		return nil, fmt.Errorf("pod manifest %s is a %s, not a Pod", path, pod.Kind)
+	}
+	if pod.Name == "" {
+		return nil, fmt.Errorf("pod manifest %s has no metadata.name", path)
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = metav1.NamespaceDefault
+	}
+	return pod, nil
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/magicsong/kidecar/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestNewStandaloneManager(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "pod.yaml")
+	err := os.WriteFile(manifest, []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: game-server-0
+  annotations:
+    foo: bar
+spec:
+  containers:
+  - name: main
+    image: game:v1
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("POD_NAME", "")
+	t.Setenv("POD_NAMESPACE", "")
+
+	mgr, err := NewManager(Options{Standalone: true, PodManifest: manifest})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer mgr.Close()
+	if os.Getenv("POD_NAME") != "game-server-0" || os.Getenv("POD_NAMESPACE") != metav1.NamespaceDefault {
+		t.Errorf("POD_NAME/POD_NAMESPACE = %s/%s, want default/game-server-0", os.Getenv("POD_NAMESPACE"), os.Getenv("POD_NAME"))
+	}
+	standalone, ok := mgr.(api.StandaloneManager)
+	if !ok || standalone.PatchFile() != DefaultPatchFile {
+		t.Errorf("NewManager() = %T, want a StandaloneManager with patch file %s", mgr, DefaultPatchFile)
+	}
+
+	pod, err := mgr.CoreV1().Pods(metav1.NamespaceDefault).Get(context.TODO(), "game-server-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() from clientset error = %v", err)
+	}
+	if pod.Annotations["foo"] != "bar" {
+		t.Errorf("pod annotations = %v, want foo=bar", pod.Annotations)
+	}
+	cached := &corev1.Pod{}
+	if err := mgr.GetClient().Get(context.TODO(), types.NamespacedName{Namespace: metav1.NamespaceDefault, Name: "game-server-0"}, cached); err != nil {
+		t.Errorf("Get() from client error = %v", err)
+	}
+	patch := []byte(`{"metadata":{"annotations":{"state":"idle"}}}`)
+	pod, err = mgr.CoreV1().Pods(metav1.NamespaceDefault).Patch(context.TODO(), "game-server-0", types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil || pod.Annotations["state"] != "idle" {
+		t.Errorf("Patch() = %v, %v, want annotation state=idle", pod.Annotations, err)
+	}
+
+	if _, err := NewManager(Options{Standalone: true, PodManifest: filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Errorf("NewManager() with a missing manifest should fail")
+	}
+}
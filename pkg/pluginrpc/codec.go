@@ -0,0 +1,38 @@
+package pluginrpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName is the content subtype of the plugin protocol, messages are plain JSON so that
+// plugins can be written without generated protobuf code
+const codecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+var _ encoding.Codec = jsonCodec{}
+
+// ServerOptions returns the options a gRPC server of the plugin protocol must be created with
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{grpc.ForceServerCodec(jsonCodec{})}
+}
+
+// DialOptions returns the options a gRPC client of the plugin protocol must be created with
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{}))}
+}
@@ -0,0 +1,48 @@
+package pluginrpc
+
+import (
+	"context"
+
+	"github.com/magicsong/kidecar/pkg/store"
+	"google.golang.org/grpc"
+)
+
+// HostServiceName is the gRPC service kidecar serves to external plugins
+const HostServiceName = "kidecar.plugin.v1.Host"
+
+// StoreDataRequest asks kidecar to store data with a storage backend
+type StoreDataRequest struct {
+	StorageConfig store.StorageConfig `json:"storageConfig"`
+	Data          string              `json:"data"`
+}
+
+// HostServer is the server side of the host service
+type HostServer interface {
+	StoreData(ctx context.Context, in *StoreDataRequest) (*Empty, error)
+}
+
+var hostServiceDesc = grpc.ServiceDesc{
+	ServiceName: HostServiceName,
+	HandlerType: (*HostServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod(HostServiceName, "StoreData", HostServer.StoreData),
+	},
+}
+
+// RegisterHostServer registers srv as the host service of s
+func RegisterHostServer(s grpc.ServiceRegistrar, srv HostServer) {
+	s.RegisterService(&hostServiceDesc, srv)
+}
+
+// HostClient is the client side of the host service
+type HostClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewHostClient(cc grpc.ClientConnInterface) *HostClient {
+	return &HostClient{cc: cc}
+}
+
+func (c *HostClient) StoreData(ctx context.Context, in *StoreDataRequest, opts ...grpc.CallOption) (*Empty, error) {
+	return invoke[Empty](ctx, c.cc, HostServiceName, "StoreData", in, opts...)
+}
@@ -0,0 +1,83 @@
+package pluginrpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/magicsong/kidecar/api"
+	"google.golang.org/grpc"
+)
+
+// PluginServiceName is the gRPC service an external plugin serves, it mirrors api.Plugin
+const PluginServiceName = "kidecar.plugin.v1.Plugin"
+
+// Empty is the message of requests and responses without fields
+type Empty struct{}
+
+// InitRequest carries the plugin name and its raw config
+type InitRequest struct {
+	Name   string          `json:"name"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// VersionResponse carries the version of the plugin
+type VersionResponse struct {
+	Version string `json:"version"`
+}
+
+// PluginServer is the server side of the plugin service.
+// Start blocks while the plugin runs: it returns the first error the plugin reports, or
+// nothing once the caller cancels the call.
+type PluginServer interface {
+	Init(ctx context.Context, in *InitRequest) (*Empty, error)
+	Start(ctx context.Context, in *Empty) (*Empty, error)
+	Stop(ctx context.Context, in *Empty) (*Empty, error)
+	Status(ctx context.Context, in *Empty) (*api.PluginStatus, error)
+	Version(ctx context.Context, in *Empty) (*VersionResponse, error)
+}
+
+var pluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: PluginServiceName,
+	HandlerType: (*PluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod(PluginServiceName, "Init", PluginServer.Init),
+		unaryMethod(PluginServiceName, "Start", PluginServer.Start),
+		unaryMethod(PluginServiceName, "Stop", PluginServer.Stop),
+		unaryMethod(PluginServiceName, "Status", PluginServer.Status),
+		unaryMethod(PluginServiceName, "Version", PluginServer.Version),
+	},
+}
+
+// RegisterPluginServer registers srv as the plugin service of s
+func RegisterPluginServer(s grpc.ServiceRegistrar, srv PluginServer) {
+	s.RegisterService(&pluginServiceDesc, srv)
+}
+
+// PluginClient is the client side of the plugin service
+type PluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPluginClient(cc grpc.ClientConnInterface) *PluginClient {
+	return &PluginClient{cc: cc}
+}
+
+func (c *PluginClient) Init(ctx context.Context, in *InitRequest, opts ...grpc.CallOption) (*Empty, error) {
+	return invoke[Empty](ctx, c.cc, PluginServiceName, "Init", in, opts...)
+}
+
+func (c *PluginClient) Start(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	return invoke[Empty](ctx, c.cc, PluginServiceName, "Start", in, opts...)
+}
+
+func (c *PluginClient) Stop(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	return invoke[Empty](ctx, c.cc, PluginServiceName, "Stop", in, opts...)
+}
+
+func (c *PluginClient) Status(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*api.PluginStatus, error) {
+	return invoke[api.PluginStatus](ctx, c.cc, PluginServiceName, "Status", in, opts...)
+}
+
+func (c *PluginClient) Version(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*VersionResponse, error) {
+	return invoke[VersionResponse](ctx, c.cc, PluginServiceName, "Version", in, opts...)
+}
@@ -0,0 +1,110 @@
+package pluginrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestJSONCodec(t *testing.T) {
+	codec := jsonCodec{}
+	if codec.Name() != codecName {
+		t.Errorf("Name() = %q, want %q", codec.Name(), codecName)
+	}
+	in := &InitRequest{Name: "probe-a", Config: json.RawMessage(`{"url":"http://localhost"}`)}
+	data, err := codec.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 消息是普通的 JSON，插件不需要生成的 protobuf 代码
+	if want := `{"name":"probe-a","config":{"url":"http://localhost"}}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+	out := &InitRequest{}
+	if err := codec.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+	}
+	if err := codec.Unmarshal([]byte("not json"), out); err == nil {
+		t.Error("Unmarshal() of invalid data should fail")
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plugin.sock")
+	// 上一次运行遗留的 socket 文件被删除
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() over a stale socket error = %v", err)
+	}
+	l.Close()
+
+	if _, err := Listen(filepath.Join(dir, "missing", "plugin.sock")); err == nil {
+		t.Error("Listen() in a missing directory should fail")
+	}
+}
+
+type fakeHost struct {
+	requests chan *StoreDataRequest
+}
+
+func (h *fakeHost) StoreData(_ context.Context, in *StoreDataRequest) (*Empty, error) {
+	h.requests <- in
+	if in.Data == "" {
+		return nil, errors.New("empty data")
+	}
+	return &Empty{}, nil
+}
+
+func TestDial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host.sock")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 连接是延迟建立的，socket 还不存在时 Dial 也会成功
+	conn, err := Dial(path)
+	if err != nil {
+		t.Fatalf("Dial() before Listen error = %v", err)
+	}
+	defer conn.Close()
+
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := &fakeHost{requests: make(chan *StoreDataRequest, 2)}
+	server := grpc.NewServer(ServerOptions()...)
+	RegisterHostServer(server, host)
+	go server.Serve(l)
+	defer server.Stop()
+
+	client := NewHostClient(conn)
+	request := &StoreDataRequest{StorageConfig: store.StorageConfig{Type: store.StorageTypeHTTPMetric}, Data: "ready"}
+	if _, err := client.StoreData(ctx, request, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("StoreData() error = %v", err)
+	}
+	if got := <-host.requests; !reflect.DeepEqual(got, request) {
+		t.Errorf("request = %+v, want %+v", got, request)
+	}
+	// 服务返回的错误保留消息
+	_, err = client.StoreData(ctx, &StoreDataRequest{})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.Unknown || s.Message() != "empty data" {
+		t.Errorf("StoreData() error = %v, want the error of the server", err)
+	}
+}
@@ -0,0 +1,38 @@
+package pluginrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// unaryMethod describes a unary method of a service whose server implements S, it replaces the
+// handler protoc-gen-go-grpc would generate
+func unaryMethod[S any, Req any, Resp any](service, name string, call func(S, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	fullMethod := "/" + service + "/" + name
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(S), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+			return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(S), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+// invoke calls a unary method of service
+func invoke[Resp any](ctx context.Context, cc grpc.ClientConnInterface, service, name string, in interface{}, opts ...grpc.CallOption) (*Resp, error) {
+	out := new(Resp)
+	if err := cc.Invoke(ctx, "/"+service+"/"+name, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,39 @@
+package pluginrpc
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// PluginSocketEnv 是外部插件需要监听的 unix socket 路径，由 kidecar 在启动插件进程时设置
+	PluginSocketEnv = "KIDECAR_PLUGIN_SOCKET"
+	// HostSocketEnv 是 kidecar 提供存储等回调服务的 unix socket 路径
+	HostSocketEnv = "KIDECAR_HOST_SOCKET"
+)
+
+// Listen listens on the unix socket at path, a stale socket file left by an earlier run is removed
+func Listen(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Dial creates a client connection to the unix socket at path, the connection is established lazily
+func Dial(path string) (*grpc.ClientConn, error) {
+	options := append(DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient("unix://"+path, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", path, err)
+	}
+	return conn, nil
+}
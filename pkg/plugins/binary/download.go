@@ -0,0 +1,244 @@
+package binary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// maxDownloadSize 是下载的二进制文件的大小上限
+	maxDownloadSize = 512 << 20
+	// downloadAttemptTimeout 是一次下载的超时时间
+	downloadAttemptTimeout = 5 * time.Minute
+	// cacheDirName 是状态目录下按 SHA-256 存放已下载二进制文件的目录，kidecar 容器重启后不必重新下载
+	cacheDirName = "binary-cache"
+)
+
+var (
+	// fallbackCacheDir 是未启用本地状态存储时的缓存目录，kidecar 容器重启后丢失
+	fallbackCacheDir = filepath.Join(os.TempDir(), "kidecar-binary-cache")
+	// downloadBackoff 是下载失败后的重试间隔
+	downloadBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: 5, Cap: 30 * time.Second}
+)
+
+// cacheDirOf returns the cache of downloaded binaries below the state dir of mgr, or the
+// fallback cache in the temp dir if the state store is disabled
+func cacheDirOf(mgr api.SidecarManager, log logr.Logger) string {
+	if mgr == nil {
+		return fallbackCacheDir
+	}
+	dir, err := mgr.Dir(cacheDirName)
+	if err != nil {
+		log.Info("state dir is not available, downloaded binaries are cached in the temp dir", "reason", err.Error())
+		return fallbackCacheDir
+	}
+	return dir
+}
+
+// errDownloadFailed is wrapped by the errors of ensureBinary
+var errDownloadFailed = errors.New("binary download failed")
+
+// permanentError marks download errors that are not retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// ensureBinary installs the binary from config.DownloadURL when config.Path is missing or does not
+// match config.Checksum, which is required with a download URL. The binary is taken from the cache
+// in cacheDir if possible, otherwise it is downloaded with retries. It is verified before it is
+// renamed into place, so config.Path never holds a partial or unverified download.
+func ensureBinary(ctx context.Context, config *v1alpha1.Binary, cacheDir string, log logr.Logger) error {
+	if config.DownloadURL == "" {
+		return nil
+	}
+	if config.Checksum == "" {
+		return fmt.Errorf("%w: checksum is required to verify the download", errDownloadFailed)
+	}
+	want, err := parseChecksum(config.Checksum)
+	if err != nil {
+		return fmt.Errorf("%w: invalid checksum: %w", errDownloadFailed, err)
+	}
+	got, err := fileChecksum(config.Path)
+	switch {
+	case err == nil && got == want:
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return fmt.Errorf("%w: %w", errDownloadFailed, err)
+	}
+
+	cached := filepath.Join(cacheDir, want)
+	if sum, err := fileChecksum(cached); err == nil && sum == want {
+		log.Info("installing binary from cache", "path", config.Path, "checksum", want)
+		if err := install(cached, config.Path, want); err != nil {
+			return fmt.Errorf("%w: %w", errDownloadFailed, err)
+		}
+		return nil
+	}
+
+	log.Info("downloading binary", "url", config.DownloadURL, "path", config.Path)
+	var lastErr error
+	err = wait.ExponentialBackoffWithContext(ctx, downloadBackoff, func(ctx context.Context) (bool, error) {
+		lastErr = download(ctx, config.DownloadURL, config.Path, want, cacheDir, log)
+		var permanent *permanentError
+		if errors.As(lastErr, &permanent) {
+			return false, lastErr
+		}
+		if lastErr != nil {
+			log.Error(lastErr, "failed to download binary, retrying", "url", config.DownloadURL)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			err = lastErr
+		}
+		return fmt.Errorf("%w: %w", errDownloadFailed, err)
+	}
+	return nil
+}
+
+// download downloads rawURL to a temp file next to path, verifies it against want, adds it to
+// the cache in cacheDir and renames it to path
+func download(ctx context.Context, rawURL, path, want, cacheDir string, log logr.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, downloadAttemptTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, rawURL)
+	}
+	if resp.ContentLength > maxDownloadSize {
+		return &permanentError{err: fmt.Errorf("%s is %d bytes, larger than the limit of %d bytes", rawURL, resp.ContentLength, maxDownloadSize)}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(resp.Body, maxDownloadSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	if n > maxDownloadSize {
+		return &permanentError{err: fmt.Errorf("%s is larger than the limit of %d bytes", rawURL, maxDownloadSize)}
+	}
+
+	got, err := fileChecksum(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &permanentError{err: fmt.Errorf("checksum of %s is sha256:%s, want sha256:%s", rawURL, got, want)}
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if err := addToCache(cacheDir, tmp.Name(), got); err != nil {
+		// 缓存只是优化，失败时仍然安装下载的文件
+		log.Error(err, "failed to cache binary")
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// addToCache copies the file at src into the cache in cacheDir under its checksum
+func addToCache(cacheDir, src, checksum string) error {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return err
+	}
+	return copyFile(src, filepath.Join(cacheDir, checksum))
+}
+
+// install copies the cached binary to path through a temp file next to it, and checks the
+// checksum of the copy before the rename
+func install(cached, path, checksum string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return copyFile(cached, path, func(tmp string) error {
+		got, err := fileChecksum(tmp)
+		if err != nil {
+			return err
+		}
+		if got != checksum {
+			return fmt.Errorf("checksum of cached binary is sha256:%s, want sha256:%s", got, checksum)
+		}
+		return nil
+	})
+}
+
+// copyFile atomically copies src to dst with mode 0755, checks run on the copy before the rename
+func copyFile(src, dst string, checks ...func(tmp string) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	for _, check := range checks {
+		if err := check(tmp.Name()); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// validateDownloadURL checks that rawURL is an absolute http or https URL
+func validateDownloadURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package binary
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestEnsureBinary(t *testing.T) {
+	content := []byte("#!/bin/sh\nexit 0\n")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次请求失败，验证重试
+		if requests.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	oldBackoff := downloadBackoff
+	defer func() { downloadBackoff = oldBackoff }()
+	cacheDir := t.TempDir()
+	downloadBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+	config := &v1alpha1.Binary{Path: filepath.Join(t.TempDir(), "bin", "tool"), Checksum: "sha256:" + checksum, DownloadURL: server.URL}
+	if err := ensureBinary(context.Background(), config, cacheDir, logr.Discard()); err != nil {
+		t.Fatalf("ensureBinary() error = %v", err)
+	}
+	if got, err := fileChecksum(config.Path); err != nil || got != checksum {
+		t.Fatalf("installed binary checksum = %s, %v, want %s", got, err, checksum)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("requests = %d, want 2", requests.Load())
+	}
+
+	// 已安装且校验和一致时不再下载，文件丢失后从缓存安装
+	if err := ensureBinary(context.Background(), config, cacheDir, logr.Discard()); err != nil {
+		t.Fatalf("ensureBinary() error = %v", err)
+	}
+	if err := os.Remove(config.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureBinary(context.Background(), config, cacheDir, logr.Discard()); err != nil {
+		t.Fatalf("ensureBinary() error = %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("requests = %d, want the cached binary to be used", requests.Load())
+	}
+	if info, err := os.Stat(config.Path); err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("installed binary = %v, %v, want mode 755", info, err)
+	}
+
+	// 校验和不一致时不会重试，也不会留下文件
+	mismatch := &v1alpha1.Binary{Path: filepath.Join(t.TempDir(), "tool"), Checksum: checksum[1:] + "0", DownloadURL: server.URL}
+	err := ensureBinary(context.Background(), mismatch, cacheDir, logr.Discard())
+	if !errors.Is(err, errDownloadFailed) {
+		t.Fatalf("ensureBinary() error = %v, want a download failure", err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("requests = %d, want a checksum mismatch not to be retried", requests.Load())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(mismatch.Path)); len(entries) != 0 {
+		t.Errorf("files left after a failed download: %v", entries)
+	}
+}
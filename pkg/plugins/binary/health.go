@@ -0,0 +1,252 @@
+package binary
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/process"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = time.Second
+	defaultFailureThreshold    = 3
+	// maxHealthCheckOutput 是健康检查失败时错误中保留的命令输出或响应内容的长度上限
+	maxHealthCheckOutput = 1024
+
+	healthCheckSchemeHTTP  = "HTTP"
+	healthCheckSchemeHTTPS = "HTTPS"
+)
+
+// health is the result of the health checks of a process
+type health string
+
+const (
+	// healthPending 表示还没有检查成功过
+	healthPending   health = "Pending"
+	healthHealthy   health = "Healthy"
+	healthUnhealthy health = "Unhealthy"
+)
+
+// errUnhealthy is wrapped by the error of a process that failed its health checks
+var errUnhealthy = errors.New("health check failed")
+
+// healthCheck checks the health of the process once
+type healthCheck func(ctx context.Context) error
+
+// newHealthCheck returns the check configured in config
+func newHealthCheck(config *v1alpha1.BinaryHealthCheck) healthCheck {
+	switch {
+	case config.Exec != nil:
+		return execCheck(config.Exec)
+	case config.HTTP != nil:
+		return httpCheck(config.HTTP)
+	default:
+		return tcpCheck(config.TCP)
+	}
+}
+
+func execCheck(config *v1alpha1.ExecHealthCheck) healthCheck {
+	return func(ctx context.Context) error {
+		out, err := process.CombinedOutput(exec.CommandContext(ctx, config.Command[0], config.Command[1:]...))
+		if err != nil {
+			if output := truncate(strings.TrimSpace(string(out))); output != "" {
+				return fmt.Errorf("%w: %s", err, output)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+func httpCheck(config *v1alpha1.HTTPHealthCheck) healthCheck {
+	scheme := "http"
+	if strings.EqualFold(config.Scheme, healthCheckSchemeHTTPS) {
+		scheme = "https"
+	}
+	path := config.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(hostOrLocalhost(config.Host), strconv.Itoa(config.Port)), path)
+	client := &http.Client{
+		Transport: &http.Transport{
+			// 和 kubelet 的 HTTPS 探针一样不校验证书
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckOutput))
+			return fmt.Errorf("GET %s returned %s: %s", url, resp.Status, truncate(strings.TrimSpace(string(body))))
+		}
+		return nil
+	}
+}
+
+func tcpCheck(config *v1alpha1.TCPHealthCheck) healthCheck {
+	address := net.JoinHostPort(hostOrLocalhost(config.Host), strconv.Itoa(config.Port))
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// runHealthChecks checks the process started with done until it exits or ctx is done. The
+// result of every check is recorded in the status, and once the checks fail failureThreshold
+// times in a row the error is sent to errCh, so the sidecar stops the process and restarts it
+// according to the restart policy.
+func (b *binary) runHealthChecks(ctx context.Context, pid int, done <-chan struct{}, errCh chan<- error) {
+	config := b.config.HealthCheck
+	check := newHealthCheck(config)
+	interval := secondsOr(config.IntervalSeconds, defaultHealthCheckInterval)
+	timeout := secondsOr(config.TimeoutSeconds, defaultHealthCheckTimeout)
+	threshold := config.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+
+	timer := time.NewTimer(time.Duration(config.InitialDelaySeconds) * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := check(checkCtx)
+		cancel()
+		if isClosed(done) || ctx.Err() != nil {
+			return
+		}
+		if failures := b.recordHealthCheck(pid, err); failures >= threshold {
+			err = fmt.Errorf("%w %d times in a row: %w", errUnhealthy, failures, err)
+			b.mu.Lock()
+			b.health, b.unhealthyErr = healthUnhealthy, err
+			b.mu.Unlock()
+			b.log.Error(err, "process is unhealthy", "pid", pid)
+			b.updateStatus(err)
+			sendError(ctx, errCh, err)
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+// recordHealthCheck records the result of a check and returns the number of consecutive failures
+func (b *binary) recordHealthCheck(pid int, err error) int {
+	b.mu.Lock()
+	if err == nil {
+		if b.health != healthHealthy {
+			b.log.Info("process is healthy", "pid", pid)
+		}
+		b.health, b.healthFailures, b.healthCheckErr = healthHealthy, 0, ""
+	} else {
+		b.healthFailures++
+		b.healthCheckErr = err.Error()
+	}
+	failures := b.healthFailures
+	b.mu.Unlock()
+	b.updateStatus(nil)
+	return failures
+}
+
+// validateHealthCheck validates the health check of the binary
+func validateHealthCheck(config *v1alpha1.BinaryHealthCheck, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	handlers := 0
+	if config.Exec != nil {
+		handlers++
+		if len(config.Exec.Command) == 0 || config.Exec.Command[0] == "" {
+			errs = append(errs, field.Required(fldPath.Child("exec", "command"), ""))
+		}
+	}
+	if config.HTTP != nil {
+		handlers++
+		errs = append(errs, validatePort(config.HTTP.Port, fldPath.Child("http", "port"))...)
+		if config.HTTP.Scheme != "" && config.HTTP.Scheme != healthCheckSchemeHTTP && config.HTTP.Scheme != healthCheckSchemeHTTPS {
+			errs = append(errs, field.NotSupported(fldPath.Child("http", "scheme"), config.HTTP.Scheme, []string{healthCheckSchemeHTTP, healthCheckSchemeHTTPS}))
+		}
+	}
+	if config.TCP != nil {
+		handlers++
+		errs = append(errs, validatePort(config.TCP.Port, fldPath.Child("tcp", "port"))...)
+	}
+	if handlers != 1 {
+		errs = append(errs, field.Invalid(fldPath, handlers, "exactly one of exec, http and tcp must be set"))
+	}
+	limits := []struct {
+		name  string
+		value int
+	}{
+		{"initialDelaySeconds", config.InitialDelaySeconds},
+		{"intervalSeconds", config.IntervalSeconds},
+		{"timeoutSeconds", config.TimeoutSeconds},
+		{"failureThreshold", config.FailureThreshold},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			errs = append(errs, field.Invalid(fldPath.Child(limit.name), limit.value, "must not be negative"))
+		}
+	}
+	return errs
+}
+
+func validatePort(port int, fldPath *field.Path) field.ErrorList {
+	if port < 1 || port > 65535 {
+		return field.ErrorList{field.Invalid(fldPath, port, "must be between 1 and 65535")}
+	}
+	return nil
+}
+
+func hostOrLocalhost(host string) string {
+	if host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func truncate(s string) string {
+	if len(s) > maxHealthCheckOutput {
+		return s[:maxHealthCheckOutput] + "..."
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package binary
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/process"
+)
+
+func TestHealthCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	closedPort := freePort(t)
+
+	tests := []struct {
+		name    string
+		config  v1alpha1.BinaryHealthCheck
+		wantErr bool
+	}{
+		{name: "exec succeeds", config: v1alpha1.BinaryHealthCheck{Exec: &v1alpha1.ExecHealthCheck{Command: []string{"/bin/sh", "-c", "exit 0"}}}},
+		{name: "exec fails", config: v1alpha1.BinaryHealthCheck{Exec: &v1alpha1.ExecHealthCheck{Command: []string{"/bin/sh", "-c", "exit 1"}}}, wantErr: true},
+		{name: "http succeeds", config: v1alpha1.BinaryHealthCheck{HTTP: &v1alpha1.HTTPHealthCheck{Host: "127.0.0.1", Port: port, Path: "healthz"}}},
+		{name: "http bad status", config: v1alpha1.BinaryHealthCheck{HTTP: &v1alpha1.HTTPHealthCheck{Host: "127.0.0.1", Port: port, Path: "/missing"}}, wantErr: true},
+		{name: "tcp succeeds", config: v1alpha1.BinaryHealthCheck{TCP: &v1alpha1.TCPHealthCheck{Host: "127.0.0.1", Port: port}}},
+		{name: "tcp refused", config: v1alpha1.BinaryHealthCheck{TCP: &v1alpha1.TCPHealthCheck{Host: "127.0.0.1", Port: closedPort}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := newHealthCheck(&tt.config)(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBinaryUnhealthy(t *testing.T) {
+	b := NewPlugin().(*binary)
+	config := &v1alpha1.Binary{
+		Path: "/bin/sh",
+		Args: []string{"-c", "sleep 60"},
+		HealthCheck: &v1alpha1.BinaryHealthCheck{
+			TCP:              &v1alpha1.TCPHealthCheck{Host: "127.0.0.1", Port: freePort(t)},
+			IntervalSeconds:  1,
+			FailureThreshold: 2,
+		},
+	}
+	if err := b.Init(config, nil); err != nil {
+		t.Fatal(err)
+	}
+	b.output = process.NewOutputSink(nil, io.Discard, io.Discard)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errCh := make(chan error)
+	go b.Start(ctx, errCh)
+	defer b.Stop(context.Background())
+
+	if err := <-errCh; !errors.Is(err, errUnhealthy) {
+		t.Fatalf("error = %v, want %v", err, errUnhealthy)
+	}
+	status, err := b.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := status.GetCondition(api.ConditionReady)
+	if ready == nil || ready.Reason != "Unhealthy" {
+		t.Errorf("ready condition = %+v, want reason Unhealthy", ready)
+	}
+	if got := status.Details["health"]; got != string(healthUnhealthy) {
+		t.Errorf("details[health] = %q, want %q", got, healthUnhealthy)
+	}
+}
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -3,20 +3,25 @@ package binary
 import (
 	"context"
 	"errors"
-	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/magicsong/kidecar/api"
 	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/process"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-func NewPlugin(config v1alpha1.Binary) api.Plugin {
+func NewPlugin() api.Plugin {
 	return &binary{
-		name:   "binary",
-		config: config,
+		name: api.BinaryPluginType,
 	}
 }
 
@@ -24,9 +29,30 @@ type binary struct {
 	name   string
 	config v1alpha1.Binary
 
-	cmd    *exec.Cmd
-	status *api.PluginStatus
-	mu     sync.Mutex
+	cmd  *exec.Cmd
+	done chan struct{} // closed once the process has exited
+	// terminate sends the stop signal to the process group of cmd once
+	terminate func() error
+	status    *api.PluginStatus
+	mu        sync.Mutex
+	log       logr.Logger
+	output    *process.OutputSink
+	// cacheDir 是已下载二进制文件的缓存目录，只在配置了 DownloadURL 时设置
+	cacheDir string
+
+	// startedAt 是当前进程的启动时间
+	startedAt time.Time
+	// lastExit 和 exitedAt 是上一个进程的退出状态和退出时间，进程被重启后仍然保留
+	lastExit *os.ProcessState
+	exitedAt time.Time
+
+	// health 是当前进程健康检查的结果，未配置健康检查时为空
+	health         health
+	healthFailures int
+	// healthCheckErr 是最近一次失败的检查的错误，检查成功后清空
+	healthCheckErr string
+	// unhealthyErr 是进程因健康检查失败而被停止的原因
+	unhealthyErr error
 }
 
 func (b *binary) Name() string {
@@ -37,37 +63,179 @@ func (b *binary) Init(config interface{}, mgr api.SidecarManager) error {
 	// 初始化插件配置
 	if cfg, ok := config.(*v1alpha1.Binary); ok {
 		b.config = *cfg
+		b.log = logf.Log.WithName("binary").WithValues("path", cfg.Path)
+		b.output = process.NewOutputSink(cfg.Output, os.Stdout, os.Stderr)
+		if cfg.DownloadURL != "" {
+			b.cacheDir = cacheDirOf(mgr, b.log)
+		}
+		b.setPendingStatus()
 		return nil
 	}
 	return errors.New("invalid config type")
 }
 
-func (b *binary) Start(ctx context.Context, errCh chan<- error) {
+// setPendingStatus sets the status until the first start, which downloads the binary first when
+// DownloadURL is set
+func (b *binary) setPendingStatus() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	reason := "Pending"
+	if b.config.DownloadURL != "" {
+		reason = "Downloading"
+	}
+	status := &api.PluginStatus{
+		Name:    b.Name(),
+		Version: b.config.Version,
+		Details: map[string]string{"path": b.config.Path},
+	}
+	status.SetCondition(api.ConditionReady, metav1.ConditionFalse, reason, "")
+	status.SetCondition(api.ConditionProgressing, metav1.ConditionTrue, reason, "")
+	status.SetCondition(api.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "")
+	b.status = status
+}
+
+// ValidateConfig implements api.ConfigValidator.
+func (b *binary) ValidateConfig(config interface{}, fldPath *field.Path) field.ErrorList {
+	cfg, ok := config.(*v1alpha1.Binary)
+	if !ok {
+		return field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, "invalid config type")}
+	}
+	var errs field.ErrorList
+	if cfg.Path == "" {
+		errs = append(errs, field.Required(fldPath.Child("path"), ""))
+	}
+	for i, env := range cfg.Env {
+		if !strings.Contains(env, "=") {
+			errs = append(errs, field.Invalid(fldPath.Child("env").Index(i), env, "must be in the form KEY=VALUE"))
+		}
+	}
+	if cfg.Checksum != "" {
+		if _, err := parseChecksum(cfg.Checksum); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("checksum"), cfg.Checksum, err.Error()))
+		}
+	}
+	if cfg.DownloadURL != "" {
+		if err := validateDownloadURL(cfg.DownloadURL); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("downloadURL"), cfg.DownloadURL, err.Error()))
+		}
+		// 下载的文件必须校验，否则被篡改的文件会被直接执行
+		if cfg.Checksum == "" {
+			errs = append(errs, field.Required(fldPath.Child("checksum"), "required when downloadURL is set"))
+		}
+	}
+	if cfg.Output != nil {
+		errs = append(errs, process.ValidateOutput(cfg.Output, fldPath.Child("output"))...)
+	}
+	if cfg.HealthCheck != nil {
+		errs = append(errs, validateHealthCheck(cfg.HealthCheck, fldPath.Child("healthCheck"))...)
+	}
+	errs = append(errs, process.ValidateStop(cfg.StopSignal, cfg.StopGracePeriodSeconds, fldPath)...)
+	if cfg.Permissions != "" {
+		if _, err := parsePermissions(cfg.Permissions); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("permissions"), cfg.Permissions, err.Error()))
+		}
+	}
+	return errs
+}
+
+// Start downloads the binary if needed and verifies it before every start, so a binary replaced
+// on a shared volume is never run, and then runs it until it exits.
+func (b *binary) Start(ctx context.Context, errCh chan<- error) {
+	if err := ensureBinary(ctx, &b.config, b.cacheDir, b.log); err != nil {
+		b.updateStatus(err)
+		sendError(ctx, errCh, err)
+		return
+	}
+	if err := verifyBinary(&b.config); err != nil {
+		b.updateStatus(err)
+		sendError(ctx, errCh, err)
+		return
+	}
+
+	b.mu.Lock()
 	b.cmd = exec.CommandContext(ctx, b.config.Path, b.config.Args...)
 	b.cmd.Env = append(os.Environ(), b.config.Env...)
-	b.cmd.Stdout = os.Stdout
-	b.cmd.Stderr = os.Stderr
-	if err := b.cmd.Start(); err != nil {
-		errCh <- err
+	// 进程在独立的进程组中运行，停止时连同它的子进程一起发送信号
+	process.SetProcessGroup(b.cmd)
+	cmd := b.cmd
+	// 停止信号只发送一次，Stop 和 ctx 取消可能先后触发
+	terminate := sync.OnceValue(func() error {
+		return process.SignalProcessGroup(cmd.Process.Pid, process.StopSignal(b.config.StopSignal))
+	})
+	cmd.Cancel = terminate
+	cmd.WaitDelay = process.StopGracePeriod(b.config.StopGracePeriodSeconds)
+	name := api.PluginNameFromContext(ctx)
+	if name == "" {
+		name = b.name
+	}
+	b.output.SetName(name, logf.FromContext(ctx).WithName("output"))
+	stdout, stderr := b.output.Writer("stdout"), b.output.Writer("stderr")
+	b.cmd.Stdout = stdout
+	b.cmd.Stderr = stderr
+	if err := process.Start(b.cmd); err != nil {
+		b.mu.Unlock()
+		b.updateStatus(err)
+		sendError(ctx, errCh, err)
 		return
 	}
 
-	go func() {
-		errCh <- b.cmd.Wait()
-	}()
+	done := make(chan struct{})
+	b.done, b.terminate = done, terminate
+	b.startedAt = time.Now()
+	b.health, b.healthFailures, b.healthCheckErr, b.unhealthyErr = "", 0, "", nil
+	if b.config.HealthCheck != nil {
+		b.health = healthPending
+	}
+	b.mu.Unlock()
+	b.updateStatus(nil)
+
+	if b.config.HealthCheck != nil {
+		go b.runHealthChecks(ctx, cmd.Process.Pid, done, errCh)
+	}
+
+	err := process.Wait(cmd)
+	if killErr := process.KillRemaining(cmd.Process.Pid); killErr != nil {
+		b.log.Error(killErr, "failed to kill remaining processes", "pid", cmd.Process.Pid)
+	}
+	stdout.Flush()
+	stderr.Flush()
+	close(done)
+	b.mu.Lock()
+	if b.unhealthyErr != nil {
+		// 进程因健康检查失败被停止，退出状态只是停止的结果
+		err = b.unhealthyErr
+	}
+	b.mu.Unlock()
+	b.updateStatus(err)
+	sendError(ctx, errCh, err)
 }
 
+// Stop sends the stop signal to the process group and waits for the process to exit. The group
+// is killed if the process is still running after the grace period.
 func (b *binary) Stop(ctx context.Context) error {
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	cmd, done, terminate := b.cmd, b.done, b.terminate
+	b.mu.Unlock()
 
-	if b.cmd != nil && b.cmd.Process != nil {
-		return b.cmd.Process.Kill()
+	if cmd == nil || cmd.Process == nil || isClosed(done) {
+		return nil
+	}
+	return process.Terminate(ctx, cmd.Process.Pid, done, terminate, process.StopGracePeriod(b.config.StopGracePeriodSeconds), b.log)
+}
+
+// StopTimeout implements api.GracefulStopper, Stop needs the grace period and the time to kill
+// the process group after it.
+func (b *binary) StopTimeout() time.Duration {
+	return process.StopGracePeriod(b.config.StopGracePeriodSeconds) + process.StopKillTimeout
+}
+
+// sendError reports err to the sidecar unless it is already shutting down
+func sendError(ctx context.Context, errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	case <-ctx.Done():
 	}
-	return nil
 }
 
 func (b *binary) Version() string {
@@ -81,23 +249,93 @@ func (b *binary) Status() (*api.PluginStatus, error) {
 	if b.status == nil {
 		return nil, errors.New("status not available")
 	}
-	return b.status, nil
+	status := b.status.DeepCopy()
+	if status.Running {
+		status.Details["uptime"] = time.Since(b.startedAt).Truncate(time.Second).String()
+	}
+	if lines := b.output.LastLines(); lines != "" {
+		status.Details["lastOutput"] = lines
+	}
+	return status, nil
 }
 
 func (b *binary) GetConfigType() interface{} {
-	return &binary{}
+	return &v1alpha1.Binary{}
 }
 
-func (b *binary) updateStatus() {
+// updateStatus refreshes the status after the process started or exited, err is the error
+// of starting or of the exit of the process
+func (b *binary) updateStatus(err error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.status = &api.PluginStatus{
-		Name:        b.Name(),
-		Version:     b.config.Version,
-		Running:     b.cmd != nil && b.cmd.Process != nil,
-		LastChecked: time.Now().Format("2006-01-02 15:04:05"),
-		Health:      "Healthy",
-		Infos:       []string{fmt.Sprintf("Binary path: %s", b.config.Path)},
+	running := b.cmd != nil && b.cmd.Process != nil && !isClosed(b.done)
+	status := &api.PluginStatus{
+		Name:    b.Name(),
+		Version: b.config.Version,
+		Running: running,
+		Details: map[string]string{"path": b.config.Path},
+	}
+	// 错误都会通过 errCh 上报，由 sidecar 计数，这里只保留最后一个错误
+	if b.status != nil {
+		status.LastError = b.status.LastError
+	}
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	if b.cmd != nil && b.cmd.Process != nil {
+		status.Details["pid"] = strconv.Itoa(b.cmd.Process.Pid)
+	}
+	if running {
+		status.Details["startedAt"] = b.startedAt.Format(time.RFC3339)
+	} else if b.cmd != nil && b.cmd.ProcessState != nil && b.cmd.ProcessState != b.lastExit {
+		b.lastExit, b.exitedAt = b.cmd.ProcessState, time.Now()
+	}
+	if b.lastExit != nil {
+		// ExitCode 在进程被信号杀死时为 -1，exitReason 中有具体的信号
+		status.Details["exitCode"] = strconv.Itoa(b.lastExit.ExitCode())
+		status.Details["exitReason"] = b.lastExit.String()
+		status.Details["exitedAt"] = b.exitedAt.Format(time.RFC3339)
+	}
+	if b.health != "" {
+		status.Details["health"] = string(b.health)
+		if b.healthFailures > 0 {
+			status.Details["healthCheckFailures"] = strconv.Itoa(b.healthFailures)
+			status.Details["lastHealthCheckError"] = b.healthCheckErr
+		}
+	}
+	switch {
+	case errors.Is(err, errUnhealthy) || b.health == healthUnhealthy:
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "Unhealthy", status.LastError)
+	case running && b.health == healthPending:
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "HealthCheckPending", b.healthCheckErr)
+	case running:
+		status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "ProcessRunning", "")
+	case errors.Is(err, errDownloadFailed):
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "DownloadFailed", status.LastError)
+	case errors.Is(err, errVerificationFailed):
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "VerificationFailed", status.LastError)
+	default:
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "ProcessNotRunning", status.LastError)
+	}
+	status.SetCondition(api.ConditionProgressing, metav1.ConditionFalse, "AsExpected", "")
+	if running && b.health == healthHealthy && b.healthFailures > 0 {
+		// 检查失败但还没有达到阈值
+		status.SetCondition(api.ConditionDegraded, metav1.ConditionTrue, "HealthCheckFailing", b.healthCheckErr)
+	} else {
+		status.SetCondition(api.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "")
+	}
+	b.status = status
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	if ch == nil {
+		return false
+	}
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
 	}
 }
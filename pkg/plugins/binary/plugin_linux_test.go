@@ -0,0 +1,88 @@
+package binary
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/process"
+)
+
+func TestBinaryStop(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		grace  int
+		// minStop 是 Stop 至少需要的时间，进程忽略停止信号时需要等到宽限期结束
+		minStop time.Duration
+	}{
+		{
+			name:   "exits on stop signal",
+			script: "sleep 60 & echo $!; wait",
+			grace:  5,
+		},
+		{
+			name:    "killed after grace period",
+			script:  "trap '' TERM; sleep 60 & echo $!; while true; do wait; done",
+			grace:   1,
+			minStop: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewPlugin().(*binary)
+			config := &v1alpha1.Binary{Path: "/bin/sh", Args: []string{"-c", tt.script}, StopGracePeriodSeconds: &tt.grace}
+			if err := b.Init(config, nil); err != nil {
+				t.Fatal(err)
+			}
+			b.output = process.NewOutputSink(nil, io.Discard, io.Discard)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errCh := make(chan error, 1)
+			go b.Start(ctx, errCh)
+
+			// 等待子进程的 pid 输出
+			var child int
+			for deadline := time.Now().Add(5 * time.Second); child == 0; time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("timeout waiting for the child process")
+				}
+				child, _ = strconv.Atoi(b.output.LastLines())
+			}
+
+			stopCtx, stopCancel := context.WithTimeout(context.Background(), b.StopTimeout())
+			defer stopCancel()
+			start := time.Now()
+			if err := b.Stop(stopCtx); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+			if took := time.Since(start); took < tt.minStop {
+				t.Errorf("Stop() took %v, want at least %v", took, tt.minStop)
+			}
+			// 子进程被杀死后成为僵尸进程，由 init 回收
+			for deadline := time.Now().Add(5 * time.Second); running(child); time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatalf("child process %d is still running", child)
+				}
+			}
+		})
+	}
+}
+
+// running reports whether the process exists and is not a zombie
+func running(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// 进程状态在命令名之后，命令名可能包含空格
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
@@ -0,0 +1,84 @@
+package binary
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"github.com/magicsong/kidecar/pkg/process"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBinaryStatusBeforeStart(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *v1alpha1.Binary
+		reason string
+	}{
+		{
+			name:   "local binary",
+			config: &v1alpha1.Binary{Path: "/bin/true"},
+			reason: "Pending",
+		},
+		{
+			name:   "downloaded binary",
+			config: &v1alpha1.Binary{Path: "/bin/true", DownloadURL: "https://example.com/true", Checksum: "sha256:00"},
+			reason: "Downloading",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewPlugin().(*binary)
+			if err := b.Init(tt.config, nil); err != nil {
+				t.Fatal(err)
+			}
+			status, err := b.Status()
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			if status.Running || status.IsReady() {
+				t.Errorf("status = %+v, want not running", status)
+			}
+			if ready := status.GetCondition(api.ConditionReady); ready == nil || ready.Reason != tt.reason {
+				t.Errorf("ready condition = %+v, want reason %s", ready, tt.reason)
+			}
+			if progressing := status.GetCondition(api.ConditionProgressing); progressing == nil || progressing.Status != metav1.ConditionTrue {
+				t.Errorf("progressing condition = %+v, want true", progressing)
+			}
+		})
+	}
+}
+
+func TestBinaryStatus(t *testing.T) {
+	b := NewPlugin().(*binary)
+	if err := b.Init(&v1alpha1.Binary{Path: "/bin/sh", Args: []string{"-c", "echo started; exit 3"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	b.output = process.NewOutputSink(nil, io.Discard, io.Discard)
+	ctx, cancel := context.WithTimeout(api.WithPluginName(context.Background(), "helper"), 10*time.Second)
+	defer cancel()
+	errCh := make(chan error)
+	go b.Start(ctx, errCh)
+	if err := <-errCh; err == nil {
+		t.Fatalf("exit error = nil, want exit status 3")
+	}
+
+	status, err := b.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Running || status.IsReady() {
+		t.Errorf("status = %+v, want not running", status)
+	}
+	for key, want := range map[string]string{"exitCode": "3", "exitReason": "exit status 3", "lastOutput": "started"} {
+		if got := status.Details[key]; got != want {
+			t.Errorf("details[%s] = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := status.Details["exitedAt"]; !ok {
+		t.Errorf("details = %v, want exitedAt", status.Details)
+	}
+}
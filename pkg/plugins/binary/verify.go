@@ -0,0 +1,93 @@
+package binary
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/magicsong/kidecar/api/v1alpha1"
+)
+
+// checksumPrefix 是校验和可选的算法前缀，目前只支持 SHA-256
+const checksumPrefix = "sha256:"
+
+// errVerificationFailed is wrapped by the errors of verifyBinary
+var errVerificationFailed = errors.New("binary verification failed")
+
+// parseChecksum returns the hex encoded SHA-256 of checksum, which may carry the sha256: prefix
+func parseChecksum(checksum string) (string, error) {
+	sum := strings.ToLower(strings.TrimPrefix(checksum, checksumPrefix))
+	if len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("must be a hex encoded SHA-256, optionally prefixed with %s", checksumPrefix)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", fmt.Errorf("must be a hex encoded SHA-256, optionally prefixed with %s", checksumPrefix)
+	}
+	return sum, nil
+}
+
+// parsePermissions returns the file mode of permissions, an octal mode like 755
+func parsePermissions(permissions string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(permissions, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("must be an octal file mode like 755")
+	}
+	return os.FileMode(mode), nil
+}
+
+// verifyBinary checks the file at config.Path against the checksum of config, and applies the
+// permissions of config. The binary must not be started if it returns an error.
+func verifyBinary(config *v1alpha1.Binary) error {
+	info, err := os.Stat(config.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errVerificationFailed, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s is not a regular file", errVerificationFailed, config.Path)
+	}
+	if config.Checksum != "" {
+		want, err := parseChecksum(config.Checksum)
+		if err != nil {
+			return fmt.Errorf("%w: invalid checksum: %w", errVerificationFailed, err)
+		}
+		got, err := fileChecksum(config.Path)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errVerificationFailed, err)
+		}
+		if got != want {
+			return fmt.Errorf("%w: checksum of %s is sha256:%s, want sha256:%s", errVerificationFailed, config.Path, got, want)
+		}
+	}
+	if config.Permissions != "" {
+		mode, err := parsePermissions(config.Permissions)
+		if err != nil {
+			return fmt.Errorf("%w: invalid permissions: %w", errVerificationFailed, err)
+		}
+		if info.Mode().Perm() != mode {
+			// 共享卷可能是只读的，无法修改时要求文件本身具有期望的权限
+			if err := os.Chmod(config.Path, mode); err != nil {
+				return fmt.Errorf("%w: permissions of %s are %o, want %o: %w", errVerificationFailed, config.Path, info.Mode().Perm(), mode, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fileChecksum returns the hex encoded SHA-256 of the file at path
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,55 @@
+package binary
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/magicsong/kidecar/api/v1alpha1"
+)
+
+func TestVerifyBinary(t *testing.T) {
+	content := []byte("#!/bin/sh\nexit 0\n")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		config   v1alpha1.Binary
+		wantErr  bool
+		wantMode os.FileMode
+	}{
+		{name: "no checks", wantMode: 0o600},
+		{name: "checksum matches", config: v1alpha1.Binary{Checksum: checksum}, wantMode: 0o600},
+		{name: "prefixed checksum matches", config: v1alpha1.Binary{Checksum: "sha256:" + checksum}, wantMode: 0o600},
+		{name: "checksum mismatch", config: v1alpha1.Binary{Checksum: "sha256:" + checksum[1:] + "0"}, wantErr: true, wantMode: 0o600},
+		{name: "permissions applied", config: v1alpha1.Binary{Checksum: checksum, Permissions: "750"}, wantMode: 0o750},
+		{name: "invalid permissions", config: v1alpha1.Binary{Permissions: "rwx"}, wantErr: true, wantMode: 0o600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bin")
+			if err := os.WriteFile(path, content, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			tt.config.Path = path
+			err := verifyBinary(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyBinary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errVerificationFailed) {
+				t.Errorf("verifyBinary() error = %v, want it to wrap errVerificationFailed", err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Errorf("mode = %o, want %o", info.Mode().Perm(), tt.wantMode)
+			}
+		})
+	}
+}
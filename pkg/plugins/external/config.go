@@ -0,0 +1,29 @@
+package external
+
+import (
+	"encoding/json"
+
+	"github.com/magicsong/kidecar/api/v1alpha1"
+)
+
+// ExternalConfig is the config of an external plugin
+type ExternalConfig struct {
+	// Path 是插件二进制文件的路径，插件需要调用 sdk.Serve
+	Path string `json:"path"`
+	// Args 是插件进程的启动参数
+	Args []string `json:"args,omitempty"`
+	// Env 是插件进程额外的环境变量，格式为 KEY=VALUE
+	Env []string `json:"env,omitempty"`
+	// SocketDir 是存放 unix socket 的目录，默认为系统临时目录
+	SocketDir string `json:"socketDir,omitempty"`
+	// StartTimeoutSeconds 是等待插件进程开始提供服务的超时时间（秒）
+	StartTimeoutSeconds int `json:"startTimeoutSeconds,omitempty"`
+	// Output 配置插件进程输出的格式、轮转文件和状态中保留的行数，与 binary 插件相同
+	Output *v1alpha1.BinaryOutput `json:"output,omitempty"`
+	// StopSignal 是插件停止后发送给进程组的信号，默认为 SIGTERM
+	StopSignal string `json:"stopSignal,omitempty"`
+	// StopGracePeriodSeconds 是从停止插件到杀死进程组之间等待的时间（秒），默认为 10 秒
+	StopGracePeriodSeconds *int `json:"stopGracePeriodSeconds,omitempty"`
+	// Config 原样传给插件的 Init
+	Config json.RawMessage `json:"config,omitempty"`
+}
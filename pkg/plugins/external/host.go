@@ -0,0 +1,29 @@
+package external
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/magicsong/kidecar/pkg/pluginrpc"
+	"github.com/magicsong/kidecar/pkg/store"
+	"github.com/magicsong/kidecar/pkg/template"
+)
+
+// hostService serves the storage backends of kidecar to the plugin process
+type hostService struct {
+	factory store.StorageFactory
+}
+
+func (h *hostService) StoreData(_ context.Context, in *pluginrpc.StoreDataRequest) (*pluginrpc.Empty, error) {
+	config := in.StorageConfig
+	if err := config.IsValid(); err != nil {
+		return nil, fmt.Errorf("invalid storage config: %w", err)
+	}
+	if err := template.ParseConfig(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := config.StoreData(h.factory, in.Data); err != nil {
+		return nil, err
+	}
+	return &pluginrpc.Empty{}, nil
+}
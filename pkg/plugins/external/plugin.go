@@ -0,0 +1,399 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/pluginrpc"
+	"github.com/magicsong/kidecar/pkg/process"
+	"github.com/magicsong/kidecar/pkg/store"
+	"google.golang.org/grpc"
+	grpcstatus "google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// pluginName is the name of the plugin.
+	pluginName = "external"
+
+	// defaultStartTimeout 是等待插件进程开始提供服务的默认超时时间
+	defaultStartTimeout = 10 * time.Second
+	// statusTimeout 是查询插件状态的超时时间
+	statusTimeout = 2 * time.Second
+)
+
+func NewPlugin() api.Plugin {
+	return &external{}
+}
+
+// external runs a plugin in its own process and drives it over the plugin service on a unix
+// socket. The process is started and stopped with the plugin, so it is supervised and restarted
+// by the sidecar like the binary plugin.
+type external struct {
+	config  ExternalConfig
+	factory store.StorageFactory
+	log     logr.Logger
+	output  *process.OutputSink
+
+	mu      sync.Mutex
+	run     *run
+	version string
+	// lastError 是最后一个错误，错误都会通过 errCh 上报，由 sidecar 计数
+	lastError string
+}
+
+// run is one run of the plugin process
+type run struct {
+	dir  string
+	cmd  *exec.Cmd
+	done chan struct{} // closed once the process has exited
+	// exitErr 是进程退出的错误，done 关闭后可读
+	exitErr error
+	conn    *grpc.ClientConn
+	client  *pluginrpc.PluginClient
+	host    *grpc.Server
+	cancel  context.CancelFunc
+}
+
+func (e *external) Name() string {
+	return pluginName
+}
+
+// ValidateConfig implements api.ConfigValidator.
+func (e *external) ValidateConfig(config interface{}, fldPath *field.Path) field.ErrorList {
+	cfg, ok := config.(*ExternalConfig)
+	if !ok {
+		return field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, "invalid config type")}
+	}
+	var errs field.ErrorList
+	if cfg.Path == "" {
+		errs = append(errs, field.Required(fldPath.Child("path"), ""))
+	}
+	for i, env := range cfg.Env {
+		if !strings.Contains(env, "=") {
+			errs = append(errs, field.Invalid(fldPath.Child("env").Index(i), env, "must be in the form KEY=VALUE"))
+		}
+	}
+	if cfg.StartTimeoutSeconds < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("startTimeoutSeconds"), cfg.StartTimeoutSeconds, "must not be negative"))
+	}
+	if cfg.Output != nil {
+		errs = append(errs, process.ValidateOutput(cfg.Output, fldPath.Child("output"))...)
+	}
+	errs = append(errs, process.ValidateStop(cfg.StopSignal, cfg.StopGracePeriodSeconds, fldPath)...)
+	return errs
+}
+
+func (e *external) Init(config interface{}, mgr api.SidecarManager) error {
+	cfg, ok := config.(*ExternalConfig)
+	if !ok {
+		return errors.New("invalid config type")
+	}
+	e.config = *cfg
+	e.factory = store.NewStorageFactory(mgr)
+	e.log = logf.Log.WithName("external").WithValues("path", cfg.Path)
+	e.output = process.NewOutputSink(cfg.Output, os.Stdout, os.Stderr)
+	return nil
+}
+
+// Start launches the plugin process, waits for it to serve the plugin service, and initializes
+// and runs the plugin in it until the plugin or the process exits. The error of the plugin or
+// of the process is sent to errCh.
+func (e *external) Start(ctx context.Context, errCh chan<- error) {
+	r, err := e.launch(ctx)
+	if err != nil {
+		e.recordError(err)
+		sendError(ctx, errCh, err)
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	e.mu.Lock()
+	e.run = r
+	e.mu.Unlock()
+
+	started := make(chan error, 1)
+	go func() {
+		_, err := r.client.Start(runCtx, &pluginrpc.Empty{})
+		started <- fromRPCError(err)
+	}()
+	select {
+	case err = <-started:
+	case <-r.done:
+		if r.exitErr != nil {
+			err = fmt.Errorf("plugin process exited: %w", r.exitErr)
+		}
+	case <-runCtx.Done():
+	}
+	if runCtx.Err() != nil {
+		// 插件被停止
+		return
+	}
+	if err != nil {
+		e.recordError(err)
+	}
+	sendError(ctx, errCh, err)
+}
+
+// launch starts the host service and the plugin process, and returns once the plugin is initialized
+func (e *external) launch(ctx context.Context) (*run, error) {
+	dir, err := os.MkdirTemp(e.config.SocketDir, "kidecar-plugin-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket dir: %w", err)
+	}
+	r := &run{dir: dir, done: make(chan struct{})}
+
+	hostSocket := filepath.Join(dir, "host.sock")
+	l, err := pluginrpc.Listen(hostSocket)
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	r.host = grpc.NewServer(pluginrpc.ServerOptions()...)
+	pluginrpc.RegisterHostServer(r.host, &hostService{factory: e.factory})
+	go func() {
+		if err := r.host.Serve(l); err != nil {
+			e.log.Error(err, "host service stopped")
+		}
+	}()
+
+	pluginSocket := filepath.Join(dir, "plugin.sock")
+	r.cmd = exec.Command(e.config.Path, e.config.Args...)
+	r.cmd.Env = append(os.Environ(), e.config.Env...)
+	r.cmd.Env = append(r.cmd.Env, pluginrpc.PluginSocketEnv+"="+pluginSocket, pluginrpc.HostSocketEnv+"="+hostSocket)
+	// 进程在独立的进程组中运行，停止时连同它的子进程一起发送信号
+	process.SetProcessGroup(r.cmd)
+	name := api.PluginNameFromContext(ctx)
+	if name == "" {
+		name = pluginName
+	}
+	e.output.SetName(name, logf.FromContext(ctx).WithName("output"))
+	stdout, stderr := e.output.Writer("stdout"), e.output.Writer("stderr")
+	r.cmd.Stdout = stdout
+	r.cmd.Stderr = stderr
+	if err := process.Start(r.cmd); err != nil {
+		close(r.done)
+		r.close()
+		return nil, fmt.Errorf("failed to start plugin process: %w", err)
+	}
+	go func() {
+		r.exitErr = process.Wait(r.cmd)
+		if err := process.KillRemaining(r.cmd.Process.Pid); err != nil {
+			e.log.Error(err, "failed to kill remaining processes", "pid", r.cmd.Process.Pid)
+		}
+		stdout.Flush()
+		stderr.Flush()
+		close(r.done)
+	}()
+
+	if r.conn, err = pluginrpc.Dial(pluginSocket); err != nil {
+		r.kill()
+		r.close()
+		return nil, err
+	}
+	r.client = pluginrpc.NewPluginClient(r.conn)
+
+	timeout := defaultStartTimeout
+	if e.config.StartTimeoutSeconds > 0 {
+		timeout = time.Duration(e.config.StartTimeoutSeconds) * time.Second
+	}
+	startCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// 进程提前退出时不必等到超时
+	go func() {
+		select {
+		case <-r.done:
+			cancel()
+		case <-startCtx.Done():
+		}
+	}()
+	version, err := r.client.Version(startCtx, &pluginrpc.Empty{}, grpc.WaitForReady(true))
+	if err == nil {
+		_, err = r.client.Init(startCtx, &pluginrpc.InitRequest{Name: name, Config: e.config.Config})
+	}
+	if err != nil {
+		r.kill()
+		r.close()
+		if isClosed(r.done) {
+			return nil, fmt.Errorf("plugin process exited before it was ready: %v", r.cmd.ProcessState)
+		}
+		return nil, fmt.Errorf("failed to initialize plugin: %w", fromRPCError(err))
+	}
+
+	e.mu.Lock()
+	e.version = version.Version
+	e.mu.Unlock()
+	e.log.Info("external plugin started", "pid", r.cmd.Process.Pid, "version", version.Version)
+	return r, nil
+}
+
+// Stop stops the plugin, then sends the stop signal to the process group and waits for the
+// process to exit. The group is killed if the process is still running after the grace period,
+// which includes the time the plugin takes to stop.
+func (e *external) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	r := e.run
+	e.run = nil
+	e.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	defer r.close()
+
+	// 先结束 Start 调用，进程随后的退出不再作为错误上报
+	r.cancel()
+	if isClosed(r.done) {
+		return nil
+	}
+	deadline := time.Now().Add(process.StopGracePeriod(e.config.StopGracePeriodSeconds))
+	var errs []error
+	stopCtx, cancel := context.WithDeadline(ctx, deadline)
+	if _, err := r.client.Stop(stopCtx, &pluginrpc.Empty{}); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop plugin: %w", fromRPCError(err)))
+	}
+	cancel()
+	pid := r.cmd.Process.Pid
+	terminate := func() error {
+		return process.SignalProcessGroup(pid, process.StopSignal(e.config.StopSignal))
+	}
+	if err := process.Terminate(ctx, pid, r.done, terminate, time.Until(deadline), e.log); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// StopTimeout implements api.GracefulStopper, Stop needs the grace period and the time to kill
+// the process group after it.
+func (e *external) StopTimeout() time.Duration {
+	return process.StopGracePeriod(e.config.StopGracePeriodSeconds) + process.StopKillTimeout
+}
+
+func (e *external) Version() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.version
+}
+
+// Status returns the status reported by the plugin, or the status of the process if the plugin
+// is not serving.
+func (e *external) Status() (*api.PluginStatus, error) {
+	e.mu.Lock()
+	r := e.run
+	e.mu.Unlock()
+
+	if r != nil && !isClosed(r.done) {
+		ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+		defer cancel()
+		status, err := r.client.Status(ctx, &pluginrpc.Empty{})
+		if err == nil {
+			if status.Name == "" {
+				status.Name = pluginName
+			}
+			if status.Version == "" {
+				status.Version = e.Version()
+			}
+			if status.Details == nil {
+				status.Details = map[string]string{}
+			}
+			status.Details["path"] = e.config.Path
+			status.Details["pid"] = strconv.Itoa(r.cmd.Process.Pid)
+			if lines := e.output.LastLines(); lines != "" {
+				status.Details["lastOutput"] = lines
+			}
+			return status, nil
+		}
+		e.recordError(fmt.Errorf("failed to get status: %w", fromRPCError(err)))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := &api.PluginStatus{
+		Name:      pluginName,
+		Version:   e.version,
+		Running:   r != nil && !isClosed(r.done),
+		LastError: e.lastError,
+		Details:   map[string]string{"path": e.config.Path},
+	}
+	if lines := e.output.LastLines(); lines != "" {
+		status.Details["lastOutput"] = lines
+	}
+	if status.Running {
+		status.Details["pid"] = strconv.Itoa(r.cmd.Process.Pid)
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "PluginNotResponding", status.LastError)
+	} else {
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "ProcessNotRunning", status.LastError)
+	}
+	status.SetCondition(api.ConditionProgressing, metav1.ConditionFalse, "AsExpected", "")
+	status.SetCondition(api.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "")
+	return status, nil
+}
+
+func (e *external) GetConfigType() interface{} {
+	return &ExternalConfig{}
+}
+
+func (e *external) recordError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastError = err.Error()
+}
+
+// kill kills the process group if the process is still running
+func (r *run) kill() {
+	if r.cmd != nil && r.cmd.Process != nil && !isClosed(r.done) {
+		_ = process.SignalProcessGroup(r.cmd.Process.Pid, os.Kill)
+		<-r.done
+	}
+}
+
+// close releases the connection, the host service and the socket dir of the run
+func (r *run) close() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	if r.host != nil {
+		r.host.Stop()
+	}
+	os.RemoveAll(r.dir)
+}
+
+// fromRPCError returns the error the plugin returned without the gRPC status wrapping
+func fromRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if s, ok := grpcstatus.FromError(err); ok {
+		return errors.New(s.Message())
+	}
+	return err
+}
+
+// sendError reports err to the sidecar unless it is already shutting down
+func sendError(ctx context.Context, errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	case <-ctx.Done():
+	}
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,253 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/process"
+	"github.com/magicsong/kidecar/pkg/sdk"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testPluginEnv 设置时测试二进制作为外部插件运行，值为插件的行为，见 TestMain
+const testPluginEnv = "KIDECAR_EXTERNAL_TEST_PLUGIN"
+
+const (
+	// modeServe 正常提供插件服务，进程在收到停止信号后退出
+	modeServe = "serve"
+	// modeStubborn 收到停止信号后不退出，只能被杀死
+	modeStubborn = "stubborn"
+	// modeExit 在提供服务前退出
+	modeExit = "exit"
+)
+
+// TestMain runs the test binary as the plugin process when it is started by the external plugin
+func TestMain(m *testing.M) {
+	mode, ok := os.LookupEnv(testPluginEnv)
+	if !ok {
+		os.Exit(m.Run())
+	}
+	if mode == modeExit {
+		os.Exit(4)
+	}
+	if err := sdk.Serve(&testPlugin{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if mode == modeStubborn {
+		time.Sleep(time.Hour)
+	}
+	os.Exit(0)
+}
+
+type testPluginConfig struct {
+	// CrashFile 不存在时插件在 Start 中创建它并崩溃，因此只崩溃一次
+	CrashFile string `json:"crashFile"`
+}
+
+// testPlugin is the plugin served by the test binary
+type testPlugin struct {
+	config testPluginConfig
+	host   *sdk.Host
+}
+
+func (p *testPlugin) Init(config json.RawMessage, host *sdk.Host) error {
+	p.host = host
+	if len(config) == 0 {
+		return nil
+	}
+	return json.Unmarshal(config, &p.config)
+}
+
+func (p *testPlugin) Start(ctx context.Context, _ chan<- error) {
+	if p.config.CrashFile != "" {
+		if _, err := os.Stat(p.config.CrashFile); os.IsNotExist(err) {
+			_ = os.WriteFile(p.config.CrashFile, nil, 0o600)
+			os.Exit(3)
+		}
+	}
+	<-ctx.Done()
+}
+
+func (p *testPlugin) Stop(context.Context) error { return nil }
+func (p *testPlugin) Version() string            { return "v1.2.3" }
+func (p *testPlugin) Status() (*api.PluginStatus, error) {
+	status := &api.PluginStatus{Name: "test", Running: true, Details: map[string]string{"instance": p.host.PluginName()}}
+	status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "Running", "")
+	return status, nil
+}
+
+// newTestExternal returns an external plugin running the test binary in mode
+func newTestExternal(t *testing.T, mode, config string, gracePeriodSeconds int) *external {
+	t.Helper()
+	e := NewPlugin().(*external)
+	cfg := &ExternalConfig{
+		Path:                   os.Args[0],
+		Env:                    []string{testPluginEnv + "=" + mode},
+		SocketDir:              t.TempDir(),
+		StopGracePeriodSeconds: &gracePeriodSeconds,
+	}
+	if config != "" {
+		cfg.Config = json.RawMessage(config)
+	}
+	if err := e.Init(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	e.output = process.NewOutputSink(nil, io.Discard, io.Discard)
+	return e
+}
+
+// start runs Start in the background, the returned channel is closed once Start returns
+func start(ctx context.Context, e *external, errCh chan<- error) <-chan struct{} {
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		e.Start(ctx, errCh)
+	}()
+	return returned
+}
+
+func waitForStatus(t *testing.T, e *external, cond func(*api.PluginStatus) bool) *api.PluginStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status, err := e.Status()
+		if err != nil {
+			t.Fatalf("Status() error = %v", err)
+		}
+		if cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for status, last status %+v", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func waitClosed(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+	}
+}
+
+// assertExited checks that the process pid is gone
+func assertExited(t *testing.T, pid string) {
+	t.Helper()
+	p, err := strconv.Atoi(pid)
+	if err != nil {
+		t.Fatalf("invalid pid %q", pid)
+	}
+	if err := syscall.Kill(p, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("plugin process %d is still running, kill error = %v", p, err)
+	}
+}
+
+func TestExternalLifecycle(t *testing.T) {
+	crashFile := filepath.Join(t.TempDir(), "crashed")
+	e := newTestExternal(t, modeServe, fmt.Sprintf(`{"crashFile":%q}`, crashFile), 5)
+	ctx, cancel := context.WithTimeout(api.WithPluginName(context.Background(), "ext-a"), 30*time.Second)
+	defer cancel()
+
+	// 第一次运行时插件进程崩溃，错误被上报，Start 返回
+	errCh := make(chan error, 1)
+	returned := start(ctx, e, errCh)
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("error of the crashed plugin = nil")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("crash of the plugin process was not reported")
+	}
+	waitClosed(t, returned, "Start to return after the crash")
+	status := waitForStatus(t, e, func(s *api.PluginStatus) bool { return !s.Running })
+	if status.IsReady() || status.LastError == "" {
+		t.Errorf("status after crash = %+v, want not ready with the last error", status)
+	}
+	// sidecar 在重启前调用 Stop 释放上一次运行
+	if err := e.Stop(ctx); err != nil {
+		t.Fatalf("Stop() after crash error = %v", err)
+	}
+
+	// 重启后插件正常运行，状态来自插件进程
+	errCh = make(chan error, 1)
+	returned = start(ctx, e, errCh)
+	status = waitForStatus(t, e, func(s *api.PluginStatus) bool { return s.IsReady() })
+	if status.Details["instance"] != "ext-a" {
+		t.Errorf("instance = %q, want the instance name passed to Init", status.Details["instance"])
+	}
+	if status.Version != "v1.2.3" || e.Version() != "v1.2.3" {
+		t.Errorf("version = %q, %q, want v1.2.3", status.Version, e.Version())
+	}
+	pid := status.Details["pid"]
+
+	if err := e.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	waitClosed(t, returned, "Start to return after Stop")
+	select {
+	case err := <-errCh:
+		t.Errorf("stopped plugin reported %v", err)
+	default:
+	}
+	assertExited(t, pid)
+	if status, _ := e.Status(); status.Running {
+		t.Errorf("status after Stop = %+v, want not running", status)
+	}
+}
+
+func TestExternalStopKillsAfterGracePeriod(t *testing.T) {
+	e := newTestExternal(t, modeStubborn, "", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	returned := start(ctx, e, make(chan error, 1))
+	pid := waitForStatus(t, e, func(s *api.PluginStatus) bool { return s.IsReady() }).Details["pid"]
+
+	begin := time.Now()
+	if err := e.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed < time.Second {
+		t.Errorf("Stop() returned after %s, want the process killed after the grace period", elapsed)
+	}
+	waitClosed(t, returned, "Start to return after Stop")
+	assertExited(t, pid)
+}
+
+func TestExternalExitsBeforeReady(t *testing.T) {
+	e := newTestExternal(t, modeExit, "", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	errCh := make(chan error, 1)
+	returned := start(ctx, e, errCh)
+	waitClosed(t, returned, "Start to return")
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("error = nil, want the exit of the plugin process")
+		}
+	default:
+		t.Fatal("exit of the plugin process was not reported")
+	}
+	status, err := e.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready := status.GetCondition(api.ConditionReady); status.Running || ready == nil || ready.Reason != "ProcessNotRunning" {
+		t.Errorf("status = %+v, want the process not running", status)
+	}
+}
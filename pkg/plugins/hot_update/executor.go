@@ -1,6 +1,7 @@
 package hot_update
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 
+	kprocess "github.com/magicsong/kidecar/pkg/process"
 	"github.com/magicsong/kidecar/pkg/store"
 	"golang.org/x/mod/semver"
 
@@ -17,11 +19,20 @@ import (
 )
 
 func (h *hotUpdate) hotUpdateHandle(w http.ResponseWriter, r *http.Request) {
+	h.status.setUpdating(true)
+	defer h.status.setUpdating(false)
+	err := h.applyHotUpdate(w, r)
+	h.status.setError(err)
+	if err != nil {
+		h.log.Error(err, "Failed to apply hot update")
+	}
+}
 
+// applyHotUpdate downloads the file of the request, loads it into the main container and stores the result
+func (h *hotUpdate) applyHotUpdate(w http.ResponseWriter, r *http.Request) error {
 	err := h.downloadHotUpdateFile(w, r)
 	if err != nil {
-		h.log.Error(err, "Failed to download file")
-		return
+		return fmt.Errorf("failed to download file: %w", err)
 	}
 
 	h.log.Info("File downloaded and saved successfully")
@@ -31,9 +42,8 @@ func (h *hotUpdate) hotUpdateHandle(w http.ResponseWriter, r *http.Request) {
 	case LoadPatchTypeSignal:
 		err := h.loadHotUpdateFileBySignal()
 		if err != nil {
-			h.log.Error(err, "Failed to load hot update file by signal")
 			h.result.Result = fmt.Sprintf("%s: Failed to load hot update file by signal: %s", h.result.Version, err)
-			return
+			return fmt.Errorf("failed to load hot update file by signal: %w", err)
 		}
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "File downloaded and update successfully")
@@ -41,22 +51,21 @@ func (h *hotUpdate) hotUpdateHandle(w http.ResponseWriter, r *http.Request) {
 	case LoadPatchTypeRequest:
 		err := h.loadHotUpdateFileByRequest()
 		if err != nil {
-			h.log.Error(err, "Failed to load hot update file by request")
-			return
+			return fmt.Errorf("failed to load hot update file by request: %w", err)
 		}
 	}
+	h.recordAppliedVersion(r.Context(), h.result.Version)
 
 	err = h.storeData()
 	if err != nil {
-		h.log.Error(err, "Failed to store data")
-		return
+		return fmt.Errorf("failed to store data: %w", err)
 	}
 
 	err = h.storeDataToConfigmap()
 	if err != nil {
-		h.log.Error(err, "failed to store data to configmap")
-		return
+		return fmt.Errorf("failed to store data to configmap: %w", err)
 	}
+	return nil
 }
 
 func (h *hotUpdate) downloadHotUpdateFile(w http.ResponseWriter, r *http.Request) error {
@@ -144,7 +153,7 @@ func (h *hotUpdate) downloadFileByUrl() error {
 
 func (h *hotUpdate) loadHotUpdateFileBySignal() error {
 	// get process list
-	psout, err := exec.Command("ps", "aux").Output()
+	psout, err := kprocess.Output(exec.Command("ps", "aux"))
 	if err != nil {
 		return fmt.Errorf("failed to get process list, err: %v", err)
 	}
@@ -163,7 +172,7 @@ func (h *hotUpdate) loadHotUpdateFileBySignal() error {
 				}
 				pid = processInfo
 				cmd := exec.Command("kill", "-s", signal, pid)
-				err := cmd.Run()
+				err := kprocess.Run(cmd)
 				if err != nil {
 					return fmt.Errorf("failed to send signal to PID, signal: %v , pid: %v, processInfo: %v, err: %v", signal, pid, processInfos, err)
 				}
@@ -207,7 +216,7 @@ func (h *hotUpdate) storeDataToConfigmap() error {
 	return nil
 }
 
-func (h *hotUpdate) setHotUpdateConfigWhenStart() error {
+func (h *hotUpdate) setHotUpdateConfigWhenStart(ctx context.Context) error {
 
 	persistentResult := &store.PersistentConfig{
 		Type: pluginName,
@@ -252,6 +261,13 @@ func (h *hotUpdate) setHotUpdateConfigWhenStart() error {
 	h.result.Version = version
 	h.result.Url = url
 
+	// kidecar 容器重启而主容器没有重启时，主容器已经加载过该版本
+	if h.isApplied(ctx, version) {
+		h.log.Info("hot update version has been applied before kidecar restarted, skip loading it again", "version", version)
+		h.result.Result = fmt.Sprintf("%s: Update success", version)
+		return nil
+	}
+
 	// down load
 	err = h.downloadFileByUrl()
 	if err != nil {
@@ -274,6 +290,7 @@ func (h *hotUpdate) setHotUpdateConfigWhenStart() error {
 			return err
 		}
 	}
+	h.recordAppliedVersion(ctx, h.result.Version)
 
 	err = h.storeData()
 	if err != nil {
@@ -1,8 +1,11 @@
 package hot_update
 
 import (
-	"fmt"
 	"regexp"
+
+	"github.com/magicsong/kidecar/api"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 const (
@@ -21,31 +24,47 @@ const (
 	OriginVersion = "OriginVersion"
 	// OriginUrl is the url of the original file.
 	OriginUrl = "OriginUrl"
+
+	// defaultListener is the sidecar listener the hot-update handler is registered on.
+	defaultListener = api.HotUpdateListener
+	// handlerPath is the path the hot-update handler of the instance named after the plugin is served on.
+	handlerPath = "/hot-update"
 )
 
-func validateConfig(hotUpdateConfig *HotUpdateConfig) error {
-	if hotUpdateConfig.LoadPatchType != LoadPatchTypeRequest && hotUpdateConfig.LoadPatchType != LoadPatchTypeSignal {
-		return fmt.Errorf("loadPatchType is empty")
-	}
-	if hotUpdateConfig.LoadPatchType == LoadPatchTypeSignal {
+// validateConfig checks the config of the hot_update plugin
+func validateConfig(hotUpdateConfig *HotUpdateConfig, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch hotUpdateConfig.LoadPatchType {
+	case LoadPatchTypeSignal:
 		if hotUpdateConfig.Signal.SignalName == "" {
-			return fmt.Errorf("SignalName is empty")
+			errs = append(errs, field.Required(fldPath.Child("signal", "signalName"), ""))
 		}
-	}
-	if hotUpdateConfig.LoadPatchType == LoadPatchTypeRequest {
+	case LoadPatchTypeRequest:
 		if hotUpdateConfig.Request.Address == "" {
-			return fmt.Errorf("address is empty")
+			errs = append(errs, field.Required(fldPath.Child("request", "address"), ""))
 		}
 		if hotUpdateConfig.Request.Port == 0 {
-			return fmt.Errorf("port is empty")
+			errs = append(errs, field.Required(fldPath.Child("request", "port"), ""))
 		}
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("loadPatchType"), hotUpdateConfig.LoadPatchType,
+			[]string{LoadPatchTypeSignal, LoadPatchTypeRequest}))
 	}
 
 	if hotUpdateConfig.FileDir == "" {
-		return fmt.Errorf("fileDir is empty")
+		errs = append(errs, field.Required(fldPath.Child("fileDir"), ""))
 	}
+	return errs
+}
 
-	return nil
+// instanceHandlerPath returns the path the hot-update handler of a plugin instance is served
+// on. Other instances than the one named after the plugin are served below /hot-update/, so
+// instances sharing a listener do not replace each other's handler.
+func instanceHandlerPath(instance string) string {
+	if instance == "" || instance == pluginName {
+		return handlerPath
+	}
+	return handlerPath + "/" + instance
 }
 
 func isValidVersion(version string) bool {
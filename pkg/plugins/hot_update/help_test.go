@@ -41,3 +41,21 @@ func Test_isValidVersion(t *testing.T) {
 		})
 	}
 }
+
+func Test_instanceHandlerPath(t *testing.T) {
+	tests := []struct {
+		instance string
+		want     string
+	}{
+		{instance: "", want: "/hot-update"},
+		{instance: "hot_update", want: "/hot-update"},
+		{instance: "assets", want: "/hot-update/assets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.instance, func(t *testing.T) {
+			if got := instanceHandlerPath(tt.instance); got != tt.want {
+				t.Errorf("instanceHandlerPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/go-logr/logr"
 	"github.com/magicsong/kidecar/api"
 	"github.com/magicsong/kidecar/pkg/store"
+	"github.com/magicsong/kidecar/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -17,6 +21,14 @@ type hotUpdate struct {
 	status *HotUpdateStatus
 	result *HotUpdateResult
 	log    logr.Logger
+	mgr    api.SidecarManager
+	// mu 保证状态切换和 inflight 计数的顺序，Stop 之后不会再有新的热更新请求
+	mu sync.Mutex
+	// state 是本地状态存储，在 Start 中按实例名打开，未启用时为 nil
+	state api.KVStore
+	// path 是注册的热更新接口，Stop 时注销
+	path     string
+	inflight sync.WaitGroup
 }
 
 type HotUpdateResult struct {
@@ -31,6 +43,9 @@ type HotUpdateConfig struct {
 	Request       Request             `json:"request,omitempty"`
 	FileDir       string              `json:"fileDir"`
 	StorageConfig store.StorageConfig `json:"storageConfig,omitempty"`
+	// Listener 是注册热更新接口的 sidecar 监听器，默认为 hot-update。
+	// 名为 hot_update 的实例的接口为 /hot-update，其他实例为 /hot-update/<实例名>
+	Listener string `json:"listener,omitempty"`
 }
 
 // Signal 发送信号量到主容器
@@ -48,64 +63,190 @@ func (h *hotUpdate) Name() string {
 	return pluginName
 }
 
-func (h *hotUpdate) Init(config interface{}, mgr api.SidecarManager) error {
+// DefaultConfig implements api.ConfigDefaulter.
+func (h *hotUpdate) DefaultConfig(config interface{}) {
 	hotUpdateConfig, ok := config.(*HotUpdateConfig)
 	if !ok {
-		return fmt.Errorf("invalid config type of hot-update, config: %v", config)
+		return
 	}
-	err := validateConfig(hotUpdateConfig)
-	if err != nil {
-		return fmt.Errorf("invalid config of hot-update, err: %v", err)
+	if hotUpdateConfig.Listener == "" {
+		hotUpdateConfig.Listener = defaultListener
+	}
+}
+
+// ValidateConfig implements api.ConfigValidator.
+func (h *hotUpdate) ValidateConfig(config interface{}, fldPath *field.Path) field.ErrorList {
+	hotUpdateConfig, ok := config.(*HotUpdateConfig)
+	if !ok {
+		return field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, "invalid config type of hot-update")}
 	}
+	return validateConfig(hotUpdateConfig, fldPath)
+}
 
+func (h *hotUpdate) Init(config interface{}, mgr api.SidecarManager) error {
+	hotUpdateConfig, ok := config.(*HotUpdateConfig)
+	if !ok {
+		return fmt.Errorf("invalid config type of hot-update, config: %v", config)
+	}
 	h.config = *hotUpdateConfig
 	h.status = &HotUpdateStatus{}
 	h.result = &HotUpdateResult{}
 	h.StorageFactory = store.NewStorageFactory(mgr)
 	h.log = logf.Log.WithName("hot-update")
+	h.mgr = mgr
 	return nil
 }
 
+// Start implements api.Plugin.
+// The handler and the state bucket are set up here because they depend on the instance name,
+// which is only known from ctx. Registering the handler again after a restart replaces the
+// previous one.
 func (h *hotUpdate) Start(ctx context.Context, errCh chan<- error) {
-	h.log.Info("start hot-update plugin")
+	instance := api.PluginNameFromContext(ctx)
+	if instance == "" {
+		instance = pluginName
+	}
+	state, err := h.mgr.Bucket(instance)
+	if err != nil {
+		h.log.Info("local state store is not available, applied versions are not remembered", "reason", err.Error())
+	}
+	h.mu.Lock()
+	h.state = state
+	h.mu.Unlock()
+	path := instanceHandlerPath(instance)
+	h.log.Info("start hot-update plugin", "listener", h.config.Listener, "path", path)
+	if err := h.registerHandler(path); err != nil {
+		h.status.setError(err)
+		h.status.setStatus("Stopped")
+		sendError(ctx, errCh, err)
+		return
+	}
 
 	// 根据pod的anno，设置最新的热更新文件
-	err := h.setHotUpdateConfigWhenStart()
+	err = h.setHotUpdateConfigWhenStart(ctx)
 	if err != nil {
 		h.log.Error(err, "Failed to set hot-update config when start")
+		h.status.setError(err)
 		h.status.setStatus("Stopped")
-		errCh <- err
+		sendError(ctx, errCh, err)
 		return
 	}
 
-	// 启动一个http服务
-	http.HandleFunc("/hot-update", h.hotUpdateHandle)
+	h.setStatus("Running")
+	<-ctx.Done()
+	h.setStatus("Stopped")
+}
 
-	err = http.ListenAndServe(":5000", nil)
-	if err != nil {
-		h.log.Error(err, "Failed to start hot-update plugin")
-		h.status.setStatus("Stopped")
-		errCh <- err
+// registerHandler serves hot-update requests on path until Stop unregisters it
+func (h *hotUpdate) registerHandler(path string) error {
+	if err := h.mgr.RegisterHandler(h.config.Listener, path, http.HandlerFunc(h.serveHotUpdate)); err != nil {
+		return fmt.Errorf("failed to register hot-update handler: %w", err)
+	}
+	h.mu.Lock()
+	h.path = path
+	h.mu.Unlock()
+	return nil
+}
+
+// unregisterHandler removes the handler registered by registerHandler, so a removed plugin
+// instance no longer gets requests
+func (h *hotUpdate) unregisterHandler() error {
+	h.mu.Lock()
+	path := h.path
+	h.path = ""
+	h.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+	if err := h.mgr.UnregisterHandler(h.config.Listener, path); err != nil {
+		return fmt.Errorf("failed to unregister hot-update handler: %w", err)
+	}
+	return nil
+}
+
+// serveHotUpdate handles hot-update requests while the plugin is running
+func (h *hotUpdate) serveHotUpdate(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.status.getStatus() != "Running" {
+		h.mu.Unlock()
+		http.Error(w, "hot-update plugin is not running", http.StatusServiceUnavailable)
 		return
 	}
-	h.status.setStatus("Running")
+	h.inflight.Add(1)
+	h.mu.Unlock()
+	defer h.inflight.Done()
+	h.hotUpdateHandle(w, r)
+}
+
+func (h *hotUpdate) setStatus(status string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.setStatus(status)
 }
 
+// Stop unregisters the hot-update handler, rejects new hot-update requests and waits for
+// in-flight updates to finish.
 func (h *hotUpdate) Stop(ctx context.Context) error {
-	//TODO implement me
-	panic("implement me")
+	h.setStatus("Stopped")
+	if err := h.unregisterHandler(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timeout waiting for in-flight hot updates: %w", ctx.Err())
+	}
+}
+
+// sendError reports err to the sidecar unless it is already shutting down
+func sendError(ctx context.Context, errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	case <-ctx.Done():
+	}
 }
 
 func (h *hotUpdate) Version() string {
-	return "v0.0.1"
+	// 内置插件与 kidecar 一起构建，使用 kidecar 的版本
+	return version.Version
 }
 
 func (h *hotUpdate) Status() (*api.PluginStatus, error) {
-	return &api.PluginStatus{
+	running := h.status.getStatus() == "Running"
+	status := &api.PluginStatus{
 		Name:    pluginName,
-		Health:  h.status.getStatus(),
-		Running: h.status.getStatus() == "Running",
-	}, nil
+		Running: running,
+		Details: map[string]string{
+			"appliedVersion": h.appliedVersion(),
+		},
+	}
+	err, count, failed := h.status.getError()
+	if err != nil {
+		status.LastError = err.Error()
+		status.ErrorCount = count
+	}
+	if running {
+		status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "Serving", "accepting hot-update requests")
+	} else {
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, api.ReasonStopped, "plugin is not running")
+	}
+	if h.status.isUpdating() {
+		status.SetCondition(api.ConditionProgressing, metav1.ConditionTrue, "Updating", "a hot update is being applied")
+	} else {
+		status.SetCondition(api.ConditionProgressing, metav1.ConditionFalse, "Idle", "")
+	}
+	if failed {
+		status.SetCondition(api.ConditionDegraded, metav1.ConditionTrue, "HotUpdateFailed", err.Error())
+	} else {
+		status.SetCondition(api.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "")
+	}
+	return status, nil
 }
 
 func (h *hotUpdate) GetConfigType() interface{} {
@@ -0,0 +1,75 @@
+package hot_update
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/manager"
+)
+
+func TestStopUnregistersHandler(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "pod.yaml")
+	if err := os.WriteFile(manifest, []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: game-server-0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("POD_NAME", "")
+	t.Setenv("POD_NAMESPACE", "")
+	mgr, err := manager.NewManager(manager.Options{Standalone: true, PodManifest: manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	address := freeAddress(t)
+	if err := mgr.AddListener(api.HotUpdateListener, address); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.StartHTTPServers(); err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.ShutdownHTTPServers(context.Background())
+
+	h := NewPlugin().(*hotUpdate)
+	if err := h.Init(&HotUpdateConfig{Listener: api.HotUpdateListener}, mgr); err != nil {
+		t.Fatal(err)
+	}
+	path := instanceHandlerPath("game")
+	if err := h.registerHandler(path); err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + address + path
+	// 插件没有运行时接口存在但拒绝请求
+	if code := get(t, url); code != http.StatusServiceUnavailable {
+		t.Errorf("status before Stop = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if err := h.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(t, url); code != http.StatusNotFound {
+		t.Errorf("status after Stop = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func get(t *testing.T, url string) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// freeAddress returns a loopback address nothing listens on
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
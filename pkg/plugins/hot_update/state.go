@@ -0,0 +1,122 @@
+package hot_update
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/info"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// appliedVersionKey 记录已经加载到主容器的版本，kidecar 容器重启而主容器没有重启时不必重新下载和加载
+const appliedVersionKey = "appliedVersion"
+
+// kidecarContainerName 是注入的 kidecar 容器名，它重启不影响主容器已经加载的版本
+const kidecarContainerName = "kidecar"
+
+// appliedRecord is the version loaded into the main containers and the container instances it
+// was loaded into. A restarted main container has lost the hot update, it gets a new container
+// ID and no longer matches the record.
+type appliedRecord struct {
+	Version    string `json:"version"`
+	Containers string `json:"containers"`
+}
+
+// appliedVersion returns the version last applied to the main container, empty if unknown
+func (h *hotUpdate) appliedVersion() string {
+	return h.appliedRecord().Version
+}
+
+func (h *hotUpdate) appliedRecord() appliedRecord {
+	state := h.stateStore()
+	if state == nil {
+		return appliedRecord{}
+	}
+	value, ok, err := state.Get(appliedVersionKey)
+	if err != nil {
+		h.log.Error(err, "Failed to get applied version from local state")
+		return appliedRecord{}
+	}
+	if !ok {
+		return appliedRecord{}
+	}
+	var record appliedRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		// 旧版本只记录了版本号，不知道加载到了哪个容器实例
+		return appliedRecord{Version: string(value)}
+	}
+	return record
+}
+
+// isApplied returns whether version was loaded into the running instances of the main containers
+func (h *hotUpdate) isApplied(ctx context.Context, version string) bool {
+	record := h.appliedRecord()
+	if record.Version != version || record.Containers == "" {
+		return false
+	}
+	containers, err := h.mainContainers(ctx)
+	if err != nil {
+		h.log.Info("unable to tell whether the main containers restarted, applying the version again", "reason", err.Error())
+		return false
+	}
+	return containers == record.Containers
+}
+
+func (h *hotUpdate) recordAppliedVersion(ctx context.Context, version string) {
+	state := h.stateStore()
+	if state == nil {
+		return
+	}
+	containers, err := h.mainContainers(ctx)
+	if err != nil {
+		h.log.Info("unable to identify the main containers, the version is applied again after a restart", "reason", err.Error())
+	}
+	value, err := json.Marshal(appliedRecord{Version: version, Containers: containers})
+	if err != nil {
+		h.log.Error(err, "Failed to encode applied version", "version", version)
+		return
+	}
+	if err := state.Put(appliedVersionKey, value, 0); err != nil {
+		h.log.Error(err, "Failed to record applied version in local state", "version", version)
+	}
+}
+
+func (h *hotUpdate) stateStore() api.KVStore {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// mainContainers identifies the running instances of the main containers by the pod UID and
+// the IDs of the containers other than kidecar, which change whenever a container restarts
+func (h *hotUpdate) mainContainers(ctx context.Context) (string, error) {
+	nsname, err := info.GetCurrentPodNamespaceAndName()
+	if err != nil {
+		return "", err
+	}
+	pod, err := h.mgr.CoreV1().Pods(nsname.Namespace).Get(ctx, nsname.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get pod %s: %w", nsname, err)
+	}
+	return containerInstances(pod)
+}
+
+func containerInstances(pod *corev1.Pod) (string, error) {
+	instances := []string{string(pod.UID)}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == kidecarContainerName {
+			continue
+		}
+		if status.ContainerID == "" {
+			return "", fmt.Errorf("container %s is not running", status.Name)
+		}
+		instances = append(instances, status.Name+"="+status.ContainerID)
+	}
+	sort.Strings(instances[1:])
+	return strings.Join(instances, ","), nil
+}
@@ -0,0 +1,39 @@
+package hot_update
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_containerInstances(t *testing.T) {
+	pod := func(statuses ...corev1.ContainerStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{UID: "uid"},
+			Status:     corev1.PodStatus{ContainerStatuses: statuses},
+		}
+	}
+	main := corev1.ContainerStatus{Name: "main", ContainerID: "containerd://a"}
+	kidecar := corev1.ContainerStatus{Name: kidecarContainerName, ContainerID: "containerd://k"}
+	got, err := containerInstances(pod(kidecar, main))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "uid,main=containerd://a"; got != want {
+		t.Errorf("containerInstances() = %q, want %q", got, want)
+	}
+	// kidecar 重启不改变主容器实例
+	kidecar.ContainerID = "containerd://k2"
+	if again, _ := containerInstances(pod(main, kidecar)); again != got {
+		t.Errorf("containerInstances() after kidecar restart = %q, want %q", again, got)
+	}
+	// 主容器重启后容器 ID 改变
+	main.ContainerID = "containerd://b"
+	if restarted, _ := containerInstances(pod(main, kidecar)); restarted == got {
+		t.Errorf("containerInstances() after main container restart = %q, want a different value", restarted)
+	}
+	if _, err := containerInstances(pod(corev1.ContainerStatus{Name: "main"})); err == nil {
+		t.Error("containerInstances() of a container that is not running should fail")
+	}
+}
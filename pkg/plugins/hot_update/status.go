@@ -5,6 +5,9 @@ import "sync"
 type HotUpdateStatus struct {
 	status           string     // 记录当前状态
 	err              error      // 记录最后一次发生的错误
+	errorCount       int        // 累计发生的错误次数
+	failed           bool       // 最近一次热更新是否失败
+	updating         bool       // 是否正在执行热更新
 	activeGoroutines int        // 当前活跃的 goroutine 数量
 	mu               sync.Mutex // 用于保护状态字段的并发访问
 }
@@ -16,17 +19,39 @@ func (h *HotUpdateStatus) setStatus(status string) {
 }
 
 func (h *HotUpdateStatus) getStatus() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	return h.status
 }
 
+// setError records the result of the last hot update, a nil err clears the failure
 func (h *HotUpdateStatus) setError(err error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.err = err
+	h.failed = err != nil
+	if err != nil {
+		h.err = err
+		h.errorCount++
+	}
+}
+
+// getError returns the last error, the number of errors and whether the last hot update failed
+func (h *HotUpdateStatus) getError() (error, int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err, h.errorCount, h.failed
+}
+
+func (h *HotUpdateStatus) setUpdating(updating bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.updating = updating
 }
 
-func (h *HotUpdateStatus) getError() error {
-	return h.err
+func (h *HotUpdateStatus) isUpdating() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.updating
 }
 
 func (h *HotUpdateStatus) incrementGoroutines() {
@@ -42,5 +67,7 @@ func (h *HotUpdateStatus) decrementGoroutines() {
 }
 
 func (h *HotUpdateStatus) getActiveGoroutines() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	return h.activeGoroutines
 }
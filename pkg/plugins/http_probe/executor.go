@@ -9,6 +9,7 @@ import (
 	"github.com/magicsong/kidecar/pkg/extractor"
 	"github.com/magicsong/kidecar/pkg/store"
 	"github.com/magicsong/kidecar/pkg/template"
+	"github.com/magicsong/kidecar/pkg/utils"
 )
 
 // Executor holds the HTTP client and provides methods for probing
@@ -62,7 +63,7 @@ func (p *Executor) Probe(config EndpointConfig) error {
 		return fmt.Errorf("failed to extract data: %v", err)
 	}
 	// Store data
-	if err := p.storeData(data.(string), &config.StorageConfig); err != nil {
+	if err := p.storeData(utils.ConvertToString(data), &config.StorageConfig); err != nil {
 		return fmt.Errorf("failed to store data: %v", err)
 	}
 	return nil
@@ -3,12 +3,19 @@ package httpprobe
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/magicsong/kidecar/api"
 	"github.com/magicsong/kidecar/pkg/store"
+	"github.com/magicsong/kidecar/pkg/utils"
+	"github.com/magicsong/kidecar/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/util/retry"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -23,6 +30,13 @@ type httpProber struct {
 	store.StorageFactory
 	status *HttpProbeStatus
 	log    logr.Logger
+
+	// cancel stops the running Start loop, done is closed once it has exited
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	// reloadConfig 接收热加载的新配置
+	reloadConfig chan *HttpProbeConfig
 }
 
 // GetConfigType implements api.Plugin.
@@ -40,15 +54,80 @@ func (h *httpProber) Init(config interface{}, mgr api.SidecarManager) error {
 	h.status = &HttpProbeStatus{}
 	h.StorageFactory = store.NewStorageFactory(mgr)
 	h.log = logf.Log.WithName("http_probe")
-	if h.config.ProbeIntervalSeconds <= 0 {
-		h.config.ProbeIntervalSeconds = 5
+	h.reloadConfig = make(chan *HttpProbeConfig, 1)
+	return nil
+}
+
+// DefaultConfig implements api.ConfigDefaulter.
+func (h *httpProber) DefaultConfig(config interface{}) {
+	if probeConfig, ok := config.(*HttpProbeConfig); ok {
+		setDefaults(probeConfig)
+	}
+}
+
+// ValidateConfig implements api.ConfigValidator.
+func (h *httpProber) ValidateConfig(config interface{}, fldPath *field.Path) field.ErrorList {
+	probeConfig, ok := config.(*HttpProbeConfig)
+	if !ok {
+		return field.ErrorList{field.TypeInvalid(fldPath, field.OmitValueType{}, "invalid config type")}
+	}
+	var errs field.ErrorList
+	for i, endpoint := range probeConfig.Endpoints {
+		path := fldPath.Child("endpoints").Index(i)
+		if endpoint.URL == "" {
+			errs = append(errs, field.Required(path.Child("url"), ""))
+		}
+		if err := endpoint.StorageConfig.IsValid(); err != nil {
+			errs = append(errs, field.Invalid(path.Child("storageConfig"), field.OmitValueType{}, err.Error()))
+		}
+		if c := endpoint.JSONPathConfig; c != nil && c.JSONPath == "" {
+			errs = append(errs, field.Required(path.Child("jsonPathConfig", "jsonPath"), ""))
+		}
+	}
+	return errs
+}
+
+func setDefaults(config *HttpProbeConfig) {
+	if config.ProbeIntervalSeconds <= 0 {
+		config.ProbeIntervalSeconds = 5
+	}
+	if config.StartDelaySeconds <= 0 {
+		config.StartDelaySeconds = 30
 	}
-	if h.config.StartDelaySeconds <= 0 {
-		h.config.StartDelaySeconds = 30
+}
+
+// Reload implements api.ConfigReloader.
+// If the plugin is running, the probe goroutines are restarted with the new config.
+func (h *httpProber) Reload(config interface{}) error {
+	probeConfig, ok := config.(*HttpProbeConfig)
+	if !ok {
+		return fmt.Errorf("invalid config type")
 	}
+	newConfig := *probeConfig
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done == nil || isClosed(h.done) {
+		h.config = newConfig
+		return nil
+	}
+	// 丢弃还未生效的旧配置
+	select {
+	case <-h.reloadConfig:
+	default:
+	}
+	h.reloadConfig <- &newConfig
 	return nil
 }
 
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
 // Name implements api.Plugin.
 func (h *httpProber) Name() string {
 	return pluginName
@@ -56,6 +135,16 @@ func (h *httpProber) Name() string {
 
 // Start implements api.Plugin.
 func (h *httpProber) Start(ctx context.Context, errorCh chan<- error) {
+	ctx, cancelStart := context.WithCancel(ctx)
+	done := make(chan struct{})
+	h.mu.Lock()
+	h.cancel = cancelStart
+	h.done = done
+	h.mu.Unlock()
+	defer close(done)
+	defer cancelStart()
+
+	h.status.setStatus("Starting")
 	// 延迟启动
 	if h.config.StartDelaySeconds > 0 {
 		h.log.Info("Delaying start", "seconds", h.config.StartDelaySeconds)
@@ -69,46 +158,54 @@ func (h *httpProber) Start(ctx context.Context, errorCh chan<- error) {
 		}
 	}
 	h.log.Info("Starting http probe plugin")
-	reloadConfig := make(chan struct{})
-	if len(h.config.Endpoints) == 0 {
-		h.log.Info("No endpoints to probe")
-		h.status.setStatus("Stopped")
-		return
-	}
 	var wg sync.WaitGroup
 	for {
 		// 为当前的一轮 goroutine 创建一个可以取消的上下文
-		ctxWithCancel, cancel := context.WithCancel(context.Background())
-		h.status.setStatus("Running")
+		ctxWithCancel, cancel := context.WithCancel(ctx)
+		if len(h.config.Endpoints) == 0 {
+			// 没有端点时继续等待，热加载添加端点后恢复探测
+			h.log.Info("No endpoints to probe, waiting for a config reload")
+			h.status.setStatus("Idle")
+		} else {
+			h.status.setStatus("Running")
+		}
 		// 启动所有的 probeAndStore goroutine
 		for _, ep := range h.config.Endpoints {
 			wg.Add(1)
 			h.status.incrementGoroutines()
 			go func(ec EndpointConfig) {
 				defer wg.Done()
+				defer h.status.decrementGoroutines()
+				// panic 交给 sidecar 处理，由它重启插件
+				defer utils.Recover(func(err *utils.PanicError) {
+					h.log.Error(err, "Probe panicked", "endpoint", ec.URL, "stack", err.Stack)
+					select {
+					case errorCh <- err:
+					case <-ctx.Done():
+					}
+				})
 				h.probeAndStore(ctxWithCancel, errorCh, ec)
-				h.status.decrementGoroutines()
 			}(ep)
 		}
 
 		select {
-		case <-reloadConfig:
+		case newConfig := <-h.reloadConfig:
 			// 收到配置重载信号，取消当前所有的 goroutine
-			fmt.Println("Received reload signal, restarting goroutines...")
+			h.log.Info("Received reload signal, restarting goroutines...")
 			cancel()
 			// 等待所有的 goroutine 退出
 			wg.Wait()
-
-			// 这里可以进行必要的配置更新操作
-			// h.config = newConfig
+			h.mu.Lock()
+			h.config = *newConfig
+			h.mu.Unlock()
 
 		case <-ctx.Done():
-			// 上下文被取消，退出
-			h.status.setStatus("Stopped")
+			// 上下文被取消，等待所有的 goroutine 退出后再返回
 			cancel()
+			wg.Wait()
+			h.status.setStatus("Stopped")
 			return
 		}
-		wg.Wait()
 		// 重启 goroutine，在下一个循环中启动新的 goroutine
 	}
 }
@@ -132,33 +229,97 @@ func (h *httpProber) probeAndStore(ctx context.Context, _ chan<- error, config E
 				}
 				return nil
 			})
+			h.status.setProbeResult(config.URL, err)
 			if err != nil {
 				h.log.Error(err, "Failed to probe", "endpoint", config.URL)
 			} else {
 				h.log.Info("Probed successfully", "endpoint", config.URL)
+				h.status.setStored()
+			}
+			select {
+			case <-ctx.Done():
+				h.log.Info("Context cancelled, exiting", "endpoint", config.URL)
+				return
+			case <-time.After(time.Second * time.Duration(h.config.ProbeIntervalSeconds)):
 			}
-			time.Sleep(time.Second * time.Duration(h.config.ProbeIntervalSeconds))
 		}
 	}
 }
 
 // Status implements api.Plugin.
+// The plugin is ready only after the first probe result has been stored, so the pod
+// is not ready before its state is known.
 func (h *httpProber) Status() (*api.PluginStatus, error) {
-	return &api.PluginStatus{
+	h.mu.Lock()
+	config := h.config
+	h.mu.Unlock()
+	state := h.status.getStatus()
+	running := state == "Running" || state == "Idle"
+	status := &api.PluginStatus{
 		Name:    pluginName,
-		Health:  h.status.getStatus(),
-		Running: h.status.getStatus() == "Running",
-	}, nil
+		Running: running,
+		Details: map[string]string{
+			"endpoints":    strconv.Itoa(len(config.Endpoints)),
+			"activeProbes": strconv.Itoa(h.status.getActiveGoroutines()),
+		},
+	}
+	if err, count := h.status.getError(); err != nil {
+		status.LastError = err.Error()
+		status.ErrorCount = count
+	}
+	switch {
+	case state == "Idle":
+		status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "NoEndpoints", "no endpoints to probe")
+		status.SetCondition(api.ConditionProgressing, metav1.ConditionFalse, "NoEndpoints", "")
+	case running && h.status.isStored():
+		status.SetCondition(api.ConditionReady, metav1.ConditionTrue, "ProbeResultStored", "probe results are stored")
+		status.SetCondition(api.ConditionProgressing, metav1.ConditionFalse, "ProbeResultStored", "")
+	case running:
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "WaitingForFirstResult", "waiting for the first probe result to be stored")
+		status.SetCondition(api.ConditionProgressing, metav1.ConditionTrue, "WaitingForFirstResult", "waiting for the first probe result to be stored")
+	case state == "Starting":
+		message := fmt.Sprintf("waiting %ds before the first probe", config.StartDelaySeconds)
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, "StartDelay", message)
+		status.SetCondition(api.ConditionProgressing, metav1.ConditionTrue, "StartDelay", message)
+	default:
+		status.SetCondition(api.ConditionReady, metav1.ConditionFalse, api.ReasonStopped, "plugin is not running")
+		status.SetCondition(api.ConditionProgressing, metav1.ConditionFalse, api.ReasonStopped, "")
+	}
+	if failing := h.status.getFailing(); len(failing) > 0 {
+		messages := make([]string, 0, len(failing))
+		for endpoint, err := range failing {
+			messages = append(messages, fmt.Sprintf("%s: %v", endpoint, err))
+		}
+		sort.Strings(messages)
+		status.SetCondition(api.ConditionDegraded, metav1.ConditionTrue, "ProbeFailed", strings.Join(messages, "; "))
+	} else {
+		status.SetCondition(api.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "")
+	}
+	return status, nil
 }
 
 // Stop implements api.Plugin.
+// Stop cancels all probe goroutines and waits for them to exit.
 func (h *httpProber) Stop(ctx context.Context) error {
-	panic("unimplemented")
+	h.mu.Lock()
+	cancel, done := h.cancel, h.done
+	h.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timeout waiting for probe goroutines to exit: %w", ctx.Err())
+	}
 }
 
 // Version implements api.Plugin.
 func (h *httpProber) Version() string {
-	return "v0.0.1"
+	// 内置插件与 kidecar 一起构建，使用 kidecar 的版本
+	return version.Version
 }
 
 func NewPlugin() api.Plugin {
@@ -0,0 +1,61 @@
+package httpprobe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/store"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReloadResumesProbing(t *testing.T) {
+	h := NewPlugin().(*httpProber)
+	if err := h.Init(&HttpProbeConfig{ProbeIntervalSeconds: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Start(ctx, errCh)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// 没有端点时插件保持运行并就绪
+	waitForStatus(t, h, func(status *api.PluginStatus) bool {
+		ready := status.GetCondition(api.ConditionReady)
+		return status.Running && ready != nil && ready.Status == metav1.ConditionTrue && ready.Reason == "NoEndpoints"
+	})
+	// 热加载添加端点后恢复探测
+	endpoint := EndpointConfig{
+		URL:           "http://127.0.0.1:1",
+		Method:        "GET",
+		StorageConfig: store.StorageConfig{Type: store.StorageTypeHTTPMetric},
+	}
+	if err := h.Reload(&HttpProbeConfig{ProbeIntervalSeconds: 1, Endpoints: []EndpointConfig{endpoint}}); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, h, func(status *api.PluginStatus) bool {
+		return status.Details["activeProbes"] == "1"
+	})
+}
+
+func waitForStatus(t *testing.T, h *httpProber, cond func(*api.PluginStatus) bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		status, err := h.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cond(status) {
+			return
+		}
+	}
+	t.Fatal("timed out waiting for the plugin status")
+}
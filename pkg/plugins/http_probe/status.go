@@ -3,10 +3,13 @@ package httpprobe
 import "sync"
 
 type HttpProbeStatus struct {
-	status           string     // 记录当前状态
-	err              error      // 记录最后一次发生的错误
-	activeGoroutines int        // 当前活跃的 goroutine 数量
-	mu               sync.Mutex // 用于保护状态字段的并发访问
+	status           string           // 记录当前状态
+	err              error            // 记录最后一次发生的错误
+	errorCount       int              // 累计发生的错误次数
+	failing          map[string]error // 最近一次探测失败的 endpoint 及其错误
+	activeGoroutines int              // 当前活跃的 goroutine 数量
+	stored           bool             // 是否已经成功存储过一次探测结果
+	mu               sync.Mutex       // 用于保护状态字段的并发访问
 }
 
 func (h *HttpProbeStatus) setStatus(status string) {
@@ -16,17 +19,54 @@ func (h *HttpProbeStatus) setStatus(status string) {
 }
 
 func (h *HttpProbeStatus) getStatus() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	return h.status
 }
 
-func (h *HttpProbeStatus) setError(err error) {
+func (h *HttpProbeStatus) setStored() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stored = true
+}
+
+func (h *HttpProbeStatus) isStored() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stored
+}
+
+// setProbeResult records the result of probing and storing an endpoint
+func (h *HttpProbeStatus) setProbeResult(endpoint string, err error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if err == nil {
+		delete(h.failing, endpoint)
+		return
+	}
+	if h.failing == nil {
+		h.failing = make(map[string]error)
+	}
+	h.failing[endpoint] = err
 	h.err = err
+	h.errorCount++
 }
 
-func (h *HttpProbeStatus) getError() error {
-	return h.err
+func (h *HttpProbeStatus) getError() (error, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err, h.errorCount
+}
+
+// getFailing returns the endpoints whose last probe failed
+func (h *HttpProbeStatus) getFailing() map[string]error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	failing := make(map[string]error, len(h.failing))
+	for endpoint, err := range h.failing {
+		failing[endpoint] = err
+	}
+	return failing
 }
 
 func (h *HttpProbeStatus) incrementGoroutines() {
@@ -42,5 +82,7 @@ func (h *HttpProbeStatus) decrementGoroutines() {
 }
 
 func (h *HttpProbeStatus) getActiveGoroutines() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	return h.activeGoroutines
 }
@@ -2,21 +2,30 @@ package plugins
 
 import (
 	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/plugins/binary"
+	"github.com/magicsong/kidecar/pkg/plugins/external"
 	"github.com/magicsong/kidecar/pkg/plugins/hot_update"
 	httpprobe "github.com/magicsong/kidecar/pkg/plugins/http_probe"
 )
 
-var PluginRegistry = make(map[string]api.Plugin)
+// PluginFactory creates a new instance of a plugin type, every configured plugin gets its own instance
+type PluginFactory func() api.Plugin
 
-func RegisterPlugin(plugin api.Plugin) {
-	if plugin.Name() == "" {
+// PluginRegistry holds the plugin factories keyed by plugin type
+var PluginRegistry = make(map[string]PluginFactory)
+
+func RegisterPlugin(factory PluginFactory) {
+	name := factory().Name()
+	if name == "" {
 		panic("plugin name is empty")
 	}
-	PluginRegistry[plugin.Name()] = plugin
+	PluginRegistry[name] = factory
 }
 
 func init() {
 	// 注册plugin
-	RegisterPlugin(httpprobe.NewPlugin())
-	RegisterPlugin(hot_update.NewPlugin())
+	RegisterPlugin(httpprobe.NewPlugin)
+	RegisterPlugin(hot_update.NewPlugin)
+	RegisterPlugin(binary.NewPlugin)
+	RegisterPlugin(external.NewPlugin)
 }
@@ -0,0 +1,78 @@
+package process
+
+import (
+	"bytes"
+	"os/exec"
+	"sync"
+)
+
+// children 记录通过 Start 启动、还没有被 exec.Cmd.Wait 回收的子进程，回收僵尸进程时必须跳过它们，
+// 否则会抢走 Wait 的退出状态
+var children = struct {
+	// starting 在启动进程时加读锁，在 WithOwnedChildren 中加写锁，保证回收时所有已经启动的子进程都已登记
+	starting sync.RWMutex
+	mu       sync.Mutex
+	pids     map[int]struct{}
+}{pids: map[int]struct{}{}}
+
+// Start starts cmd and registers its process as owned by cmd until Wait returns, so the zombie
+// reaper leaves it to cmd.Wait
+func Start(cmd *exec.Cmd) error {
+	children.starting.RLock()
+	defer children.starting.RUnlock()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	children.mu.Lock()
+	children.pids[cmd.Process.Pid] = struct{}{}
+	children.mu.Unlock()
+	return nil
+}
+
+// Wait waits for cmd started with Start to exit and unregisters its process
+func Wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	children.mu.Lock()
+	delete(children.pids, cmd.Process.Pid)
+	children.mu.Unlock()
+	return err
+}
+
+// Run starts cmd with Start and waits for it to exit
+func Run(cmd *exec.Cmd) error {
+	if err := Start(cmd); err != nil {
+		return err
+	}
+	return Wait(cmd)
+}
+
+// Output runs cmd with Run and returns its standard output
+func Output(cmd *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := Run(cmd)
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs cmd with Run and returns its standard output and standard error
+func CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := Run(cmd)
+	return out.Bytes(), err
+}
+
+// WithOwnedChildren calls f while no process is being started with Start. owned reports
+// whether a pid was started with Start and is still to be waited for by its exec.Cmd, so every
+// other zombie child seen by f can be reaped.
+func WithOwnedChildren(f func(owned func(pid int) bool)) {
+	children.starting.Lock()
+	defer children.starting.Unlock()
+	f(func(pid int) bool {
+		children.mu.Lock()
+		defer children.mu.Unlock()
+		_, ok := children.pids[pid]
+		return ok
+	})
+}
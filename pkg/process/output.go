@@ -0,0 +1,243 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// OutputFormatPrefix 表示每行输出加上插件名前缀后写入 kidecar 的标准输出
+	OutputFormatPrefix = "prefix"
+	// OutputFormatJSON 表示每行输出写成 kidecar 的结构化日志
+	OutputFormatJSON = "json"
+
+	defaultOutputMaxSizeMB = 10
+	defaultOutputMaxFiles  = 3
+	defaultOutputTailLines = 20
+	// maxLineLength 是一行输出的长度上限，超过时按该长度拆分
+	maxLineLength = 64 << 10
+)
+
+// ValidateOutput validates the output config of a process
+func ValidateOutput(config *v1alpha1.BinaryOutput, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if config.Format != "" && config.Format != OutputFormatPrefix && config.Format != OutputFormatJSON {
+		errs = append(errs, field.NotSupported(fldPath.Child("format"), config.Format, []string{OutputFormatPrefix, OutputFormatJSON}))
+	}
+	limits := []struct {
+		name  string
+		value int
+	}{{"maxSizeMB", config.MaxSizeMB}, {"maxFiles", config.MaxFiles}, {"tailLines", config.TailLines}}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			errs = append(errs, field.Invalid(fldPath.Child(limit.name), limit.value, "must not be negative"))
+		}
+	}
+	return errs
+}
+
+// OutputSink handles the lines the process writes to stdout and stderr: it writes them to the
+// kidecar log, to the rotated output files if configured, and keeps the last lines for the status.
+// The sink lives as long as the plugin, so the last lines survive a restart of the process.
+type OutputSink struct {
+	mu     sync.Mutex
+	config v1alpha1.BinaryOutput
+	name   string
+	log    logr.Logger
+	stdout io.Writer
+	stderr io.Writer
+	file   *rotatingFile
+	tail   []string
+}
+
+// NewOutputSink returns a sink that writes the prefixed lines to stdout and stderr
+func NewOutputSink(config *v1alpha1.BinaryOutput, stdout, stderr io.Writer) *OutputSink {
+	s := &OutputSink{stdout: stdout, stderr: stderr, log: logr.Discard()}
+	if config != nil {
+		s.config = *config
+	}
+	if s.config.Format == "" {
+		s.config.Format = OutputFormatPrefix
+	}
+	if s.config.TailLines <= 0 {
+		s.config.TailLines = defaultOutputTailLines
+	}
+	return s
+}
+
+// SetName sets the name of the plugin instance the output is tagged with
+func (s *OutputSink) SetName(name string, log logr.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.name != name && s.file != nil {
+		s.file.close()
+		s.file = nil
+	}
+	s.name, s.log = name, log
+}
+
+// Writer returns the writer of a stream of the process, stream is stdout or stderr
+func (s *OutputSink) Writer(stream string) *LineWriter {
+	return &LineWriter{sink: s, stream: stream}
+}
+
+func (s *OutputSink) writeLine(stream, line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.config.Format {
+	case OutputFormatJSON:
+		s.log.Info(line, "stream", stream)
+	default:
+		out := s.stdout
+		if stream == "stderr" {
+			out = s.stderr
+		}
+		fmt.Fprintf(out, "[%s] %s\n", s.name, line)
+	}
+
+	if s.config.Dir != "" {
+		if s.file == nil {
+			s.file = newRotatingFile(filepath.Join(s.config.Dir, s.name+".log"), s.config.MaxSizeMB, s.config.MaxFiles)
+		}
+		if err := s.file.write([]byte(line + "\n")); err != nil {
+			s.log.Error(err, "failed to write output file")
+		}
+	}
+
+	if len(s.tail) >= s.config.TailLines {
+		s.tail = append(s.tail[:0], s.tail[len(s.tail)-s.config.TailLines+1:]...)
+	}
+	s.tail = append(s.tail, line)
+}
+
+// LastLines returns the last lines of output, oldest first
+func (s *OutputSink) LastLines() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.tail, "\n")
+}
+
+// Close closes the output file, it is opened again on the next write
+func (s *OutputSink) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.close()
+		s.file = nil
+	}
+}
+
+// LineWriter splits a stream of the process into lines for the sink
+type LineWriter struct {
+	sink   *OutputSink
+	stream string
+	buf    []byte
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.sink.writeLine(w.stream, strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	for len(w.buf) >= maxLineLength {
+		w.sink.writeLine(w.stream, string(w.buf[:maxLineLength]))
+		w.buf = w.buf[maxLineLength:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line if the process exited without a trailing newline
+func (w *LineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.sink.writeLine(w.stream, string(w.buf))
+		w.buf = nil
+	}
+}
+
+// rotatingFile is a file that is rotated to path.1 ... path.N once it reaches maxSize
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func newRotatingFile(path string, maxSizeMB, maxFiles int) *rotatingFile {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultOutputMaxSizeMB
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultOutputMaxFiles
+	}
+	return &rotatingFile{path: path, maxSize: int64(maxSizeMB) << 20, maxFiles: maxFiles}
+}
+
+func (r *rotatingFile) write(p []byte) error {
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts path.i to path.i+1, dropping the oldest file, and starts a new path
+func (r *rotatingFile) rotate() error {
+	r.close()
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) close() {
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
@@ -0,0 +1,59 @@
+package process
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/api/v1alpha1"
+)
+
+func TestOutputSink(t *testing.T) {
+	dir := t.TempDir()
+	var stdout bytes.Buffer
+	sink := NewOutputSink(&v1alpha1.BinaryOutput{Dir: dir, TailLines: 2}, &stdout, io.Discard)
+	sink.SetName("helper", logr.Discard())
+
+	w := sink.Writer("stdout")
+	w.Write([]byte("first\nsec"))
+	w.Write([]byte("ond\r\nthird"))
+	w.Flush()
+
+	if got, want := stdout.String(), "[helper] first\n[helper] second\n[helper] third\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if got, want := sink.LastLines(), "second\nthird"; got != want {
+		t.Errorf("LastLines() = %q, want %q", got, want)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "helper.log"))
+	if err != nil || string(data) != "first\nsecond\nthird\n" {
+		t.Errorf("output file = %q, %v", data, err)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	r := newRotatingFile(path, 1, 2)
+	r.maxSize = 10
+	defer r.close()
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if err := r.write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{"out.log": "dddddddd", "out.log.1": "cccccccc", "out.log.2": "bbbbbbbb"}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != len(want) {
+		t.Errorf("files = %v, want %d files", entries, len(want))
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(path), name))
+		if err != nil || strings.TrimSpace(string(data)) != content {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, content)
+		}
+	}
+}
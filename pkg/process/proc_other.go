@@ -0,0 +1,34 @@
+//go:build !unix
+
+package process
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// signals 是 StopSignal 支持的信号，其他平台上只能直接杀死进程
+var signals = map[string]os.Signal{
+	"SIGKILL": os.Kill,
+}
+
+// SetProcessGroup does nothing, process groups are only supported on unix
+func SetProcessGroup(cmd *exec.Cmd) {}
+
+// SignalProcessGroup kills the process, its children are not signalled on this platform
+func SignalProcessGroup(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := p.Signal(sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// KillRemaining does nothing, the children of the process are not tracked on this platform
+func KillRemaining(pid int) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package process holds what the binary and external plugins share to run a child process: it
+// runs the process in its own process group, stops the group gracefully, and handles its output.
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// DefaultStopSignal 是默认的停止信号
+	DefaultStopSignal = "SIGTERM"
+	// DefaultStopGracePeriod 是发送停止信号后默认等待进程退出的时间
+	DefaultStopGracePeriod = 10 * time.Second
+	// StopKillTimeout 是宽限期结束、杀死进程组后等待进程退出的时间
+	StopKillTimeout = 5 * time.Second
+)
+
+// ParseSignal parses a signal name such as SIGTERM or TERM
+func ParseSignal(name string) (os.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := signals[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal %s", name)
+	}
+	return sig, nil
+}
+
+// StopSignal returns the signal the process group is stopped with, name is empty for the default
+func StopSignal(name string) os.Signal {
+	if name == "" {
+		name = DefaultStopSignal
+	}
+	if sig, err := ParseSignal(name); err == nil {
+		return sig
+	}
+	return os.Kill
+}
+
+// StopGracePeriod returns the time the process is given to exit after the stop signal
+func StopGracePeriod(seconds *int) time.Duration {
+	if seconds == nil {
+		return DefaultStopGracePeriod
+	}
+	return time.Duration(*seconds) * time.Second
+}
+
+// ValidateStop validates the stop signal and grace period of a process, fldPath is the path of
+// the struct holding the stopSignal and stopGracePeriodSeconds fields
+func ValidateStop(signal string, gracePeriodSeconds *int, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if signal != "" {
+		if _, err := ParseSignal(signal); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("stopSignal"), signal, err.Error()))
+		}
+	}
+	if gracePeriodSeconds != nil && *gracePeriodSeconds < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("stopGracePeriodSeconds"), *gracePeriodSeconds, "must not be negative"))
+	}
+	return errs
+}
+
+// Terminate stops the process group led by pid: it calls terminate to send the stop signal and
+// waits for done to be closed. The group is killed if the process is still running after the
+// grace period or once ctx is done.
+func Terminate(ctx context.Context, pid int, done <-chan struct{}, terminate func() error, grace time.Duration, log logr.Logger) error {
+	if err := terminate(); err != nil {
+		return fmt.Errorf("failed to signal process %d: %w", pid, err)
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		log.Info("process did not exit within the grace period, killing it", "pid", pid)
+	case <-ctx.Done():
+	}
+	if err := SignalProcessGroup(pid, os.Kill); err != nil {
+		return fmt.Errorf("failed to kill process %d: %w", pid, err)
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timeout waiting for process %d to exit: %w", pid, ctx.Err())
+	}
+}
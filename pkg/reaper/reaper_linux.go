@@ -0,0 +1,138 @@
+// Package reaper reaps zombie processes when kidecar is the init process of its container.
+// Orphaned children of the binary plugins are then reparented to kidecar, which has to wait
+// for them. The children started through the process package are left to their exec.Cmd.
+package reaper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/pkg/process"
+)
+
+const (
+	// scanInterval 是扫描僵尸进程的间隔，收到 SIGCHLD 时也会扫描
+	scanInterval = time.Second
+	// minZombieAge 是回收前僵尸进程至少存在的时间，没有通过 process 包启动的子进程会在
+	// exec.Cmd.Wait 中立即回收，避免抢走它们的退出状态
+	minZombieAge = time.Second
+)
+
+// Start reaps zombie children in the background until ctx is done, if kidecar is PID 1. In a
+// pod that shares the process namespace the pause process is PID 1 and reaps the orphans.
+func Start(ctx context.Context, log logr.Logger) {
+	if os.Getpid() != 1 {
+		return
+	}
+	log.Info("running as pid 1, reaping zombie processes")
+	go run(ctx, log)
+}
+
+func run(ctx context.Context, log logr.Logger) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGCHLD)
+	defer signal.Stop(sigCh)
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+
+	// seen 记录僵尸进程第一次被发现的时间
+	seen := map[int]time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+		case <-ticker.C:
+		}
+		seen = reap(seen, log)
+	}
+}
+
+// reap waits for the zombie children that are not owned by an exec.Cmd and have been zombies
+// for at least minZombieAge, and returns the zombies to wait for later
+func reap(seen map[int]time.Time, log logr.Logger) map[int]time.Time {
+	next := map[int]time.Time{}
+	process.WithOwnedChildren(func(owned func(pid int) bool) {
+		zombies, err := zombieChildren(os.Getpid())
+		if err != nil {
+			log.Error(err, "failed to list zombie processes")
+			next = seen
+			return
+		}
+		now := time.Now()
+		for _, pid := range zombies {
+			if owned(pid) {
+				continue
+			}
+			first, ok := seen[pid]
+			if !ok {
+				first = now
+			}
+			if now.Sub(first) < minZombieAge {
+				next[pid] = first
+				continue
+			}
+			var ws syscall.WaitStatus
+			wpid, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+			switch {
+			case err != nil && !errors.Is(err, syscall.ECHILD):
+				log.Error(err, "failed to reap zombie process", "pid", pid)
+			case wpid == pid:
+				log.V(1).Info("reaped zombie process", "pid", pid, "exitCode", ws.ExitStatus())
+			}
+		}
+	})
+	return next
+}
+
+// zombieChildren returns the zombie processes whose parent is ppid
+func zombieChildren(ppid int) ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var zombies []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			// 进程已经退出
+			continue
+		}
+		state, parent, err := parseStat(stat)
+		if err == nil && state == "Z" && parent == ppid {
+			zombies = append(zombies, pid)
+		}
+	}
+	return zombies, nil
+}
+
+// parseStat returns the state and the parent pid from the content of /proc/<pid>/stat
+func parseStat(stat []byte) (string, int, error) {
+	// 命令名在括号中，可能包含空格和括号，状态和父进程在最后一个右括号之后
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid stat %q", stat)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return "", 0, fmt.Errorf("invalid stat %q", stat)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid stat %q: %w", stat, err)
+	}
+	return fields[0], ppid, nil
+}
@@ -0,0 +1,115 @@
+package reaper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/magicsong/kidecar/pkg/process"
+)
+
+func TestParseStat(t *testing.T) {
+	tests := []struct {
+		name      string
+		stat      string
+		wantState string
+		wantPPID  int
+		wantErr   bool
+	}{
+		{
+			name:      "zombie",
+			stat:      "42 (sleep) Z 1 42 42 0 -1 4227084 0 0",
+			wantState: "Z",
+			wantPPID:  1,
+		},
+		{
+			name:      "command with spaces and parentheses",
+			stat:      "43 (my (odd) cmd) S 7 43 43 0 -1",
+			wantState: "S",
+			wantPPID:  7,
+		},
+		{
+			name:    "truncated",
+			stat:    "44 (sleep",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, ppid, err := parseStat([]byte(tt.stat))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if state != tt.wantState || ppid != tt.wantPPID {
+				t.Errorf("parseStat() = %s, %d, want %s, %d", state, ppid, tt.wantState, tt.wantPPID)
+			}
+		})
+	}
+}
+
+func TestReap(t *testing.T) {
+	// 启动后不调用 Wait，进程退出后成为僵尸进程
+	cmd := exec.Command("/bin/true")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+	proc := fmt.Sprintf("/proc/%d", pid)
+
+	seen := map[int]time.Time{}
+	for deadline := time.Now().Add(5 * time.Second); len(seen) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("process %d did not become a zombie", pid)
+		}
+		seen = reap(seen, logr.Discard())
+	}
+	// 新发现的僵尸进程不会立即被回收
+	if _, err := os.Stat(proc); err != nil {
+		t.Fatalf("zombie process %d was reaped before minZombieAge: %v", pid, err)
+	}
+
+	time.Sleep(minZombieAge)
+	seen = reap(seen, logr.Discard())
+	if _, err := os.Stat(proc); !os.IsNotExist(err) {
+		t.Errorf("zombie process %d was not reaped, stat error = %v", pid, err)
+	}
+	if len(seen) != 0 {
+		t.Errorf("seen = %v, want empty", seen)
+	}
+}
+
+func TestReapSkipsOwnedChildren(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	if err := process.Start(cmd); err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+	// 等待进程退出成为僵尸进程，超过 minZombieAge 后仍然不能被回收
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		zombies, err := zombieChildren(os.Getpid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Contains(zombies, pid) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process %d did not become a zombie", pid)
+		}
+	}
+	seen := reap(map[int]time.Time{pid: time.Now().Add(-minZombieAge)}, logr.Discard())
+	if len(seen) != 0 {
+		t.Errorf("seen = %v, want empty", seen)
+	}
+
+	err := process.Wait(cmd)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Wait() error = %v, want exit status 3", err)
+	}
+}
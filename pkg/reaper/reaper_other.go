@@ -0,0 +1,14 @@
+//go:build !linux
+
+// Package reaper reaps zombie processes when kidecar is the init process of its container. It
+// only does so on linux.
+package reaper
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+)
+
+// Start does nothing, zombie processes are only reaped on linux
+func Start(ctx context.Context, log logr.Logger) {}
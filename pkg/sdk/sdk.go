@@ -0,0 +1,157 @@
+// Package sdk is used to write kidecar plugins that run in their own process. kidecar starts the
+// plugin binary configured in an external plugin, the binary calls Serve, and kidecar drives the
+// plugin over a gRPC service on a unix socket.
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/pluginrpc"
+	"github.com/magicsong/kidecar/pkg/store"
+	"google.golang.org/grpc"
+)
+
+// Plugin is implemented by external plugins, it mirrors api.Plugin. The plugin gets its raw
+// config from the plugin config in kidecar, and reaches kidecar through host instead of a
+// SidecarManager.
+type Plugin interface {
+	Init(config json.RawMessage, host *Host) error
+	Start(ctx context.Context, errCh chan<- error)
+	Stop(ctx context.Context) error
+	Version() string
+	Status() (*api.PluginStatus, error)
+}
+
+// Host is the kidecar the plugin runs in
+type Host struct {
+	client *pluginrpc.HostClient
+	name   string
+}
+
+// PluginName returns the name of the plugin instance in the kidecar config, it is set before Init
+func (h *Host) PluginName() string {
+	return h.name
+}
+
+// StoreData stores data with the storage backend of config, like the builtin plugins do
+func (h *Host) StoreData(ctx context.Context, config *store.StorageConfig, data string) error {
+	if h.client == nil {
+		return fmt.Errorf("kidecar host is not available, %s is not set", pluginrpc.HostSocketEnv)
+	}
+	_, err := h.client.StoreData(ctx, &pluginrpc.StoreDataRequest{StorageConfig: *config, Data: data})
+	return err
+}
+
+// Serve serves plugin on the socket kidecar passes in the environment until the process is
+// terminated. It is meant to be called from the main function of the plugin binary.
+func Serve(plugin Plugin) error {
+	socket := os.Getenv(pluginrpc.PluginSocketEnv)
+	if socket == "" {
+		return fmt.Errorf("%s is not set, the plugin must be started by kidecar", pluginrpc.PluginSocketEnv)
+	}
+	l, err := pluginrpc.Listen(socket)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	return serve(ctx, l, os.Getenv(pluginrpc.HostSocketEnv), plugin)
+}
+
+// serve serves plugin on l until ctx is done
+func serve(ctx context.Context, l net.Listener, hostSocket string, plugin Plugin) error {
+	host := &Host{}
+	if hostSocket != "" {
+		conn, err := pluginrpc.Dial(hostSocket)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		host.client = pluginrpc.NewHostClient(conn)
+	}
+	server := grpc.NewServer(pluginrpc.ServerOptions()...)
+	pluginrpc.RegisterPluginServer(server, &pluginServer{plugin: plugin, host: host})
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+	if err := server.Serve(l); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// pluginServer adapts a Plugin to the plugin service
+type pluginServer struct {
+	plugin Plugin
+	host   *Host
+
+	mu sync.Mutex
+	// cancel 结束当前一次运行
+	cancel context.CancelFunc
+}
+
+func (s *pluginServer) Init(_ context.Context, in *pluginrpc.InitRequest) (*pluginrpc.Empty, error) {
+	s.host.name = in.Name
+	return &pluginrpc.Empty{}, s.plugin.Init(in.Config, s.host)
+}
+
+// Start runs the plugin until it reports an error, returns from Start or the call is cancelled
+func (s *pluginServer) Start(ctx context.Context, _ *pluginrpc.Empty) (*pluginrpc.Empty, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	errCh := make(chan error, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		s.plugin.Start(runCtx, errCh)
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return nil, err
+		}
+	case <-returned:
+		// Start 可能在返回前把错误放进了有缓冲的 errCh
+		select {
+		case err := <-errCh:
+			if err != nil {
+				return nil, err
+			}
+		default:
+		}
+	case <-runCtx.Done():
+	}
+	return &pluginrpc.Empty{}, nil
+}
+
+func (s *pluginServer) Stop(ctx context.Context, _ *pluginrpc.Empty) (*pluginrpc.Empty, error) {
+	err := s.plugin.Stop(ctx)
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+	return &pluginrpc.Empty{}, err
+}
+
+func (s *pluginServer) Status(context.Context, *pluginrpc.Empty) (*api.PluginStatus, error) {
+	return s.plugin.Status()
+}
+
+func (s *pluginServer) Version(context.Context, *pluginrpc.Empty) (*pluginrpc.VersionResponse, error) {
+	return &pluginrpc.VersionResponse{Version: s.plugin.Version()}, nil
+}
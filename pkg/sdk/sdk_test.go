@@ -0,0 +1,118 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/magicsong/kidecar/api"
+	"github.com/magicsong/kidecar/pkg/pluginrpc"
+	"github.com/magicsong/kidecar/pkg/store"
+	"google.golang.org/grpc"
+)
+
+type fakePlugin struct {
+	host    *Host
+	config  json.RawMessage
+	stopped chan struct{}
+}
+
+func (p *fakePlugin) Init(config json.RawMessage, host *Host) error {
+	p.config, p.host = config, host
+	return nil
+}
+
+func (p *fakePlugin) Start(ctx context.Context, errCh chan<- error) {
+	err := p.host.StoreData(ctx, &store.StorageConfig{Type: store.StorageTypeHTTPMetric}, "ready")
+	select {
+	case errCh <- err:
+	case <-ctx.Done():
+	}
+}
+
+func (p *fakePlugin) Stop(context.Context) error {
+	close(p.stopped)
+	return nil
+}
+
+func (p *fakePlugin) Version() string {
+	return "v1"
+}
+
+func (p *fakePlugin) Status() (*api.PluginStatus, error) {
+	return &api.PluginStatus{Name: "fake", Running: true}, nil
+}
+
+type fakeHost struct {
+	data chan string
+}
+
+func (h *fakeHost) StoreData(_ context.Context, in *pluginrpc.StoreDataRequest) (*pluginrpc.Empty, error) {
+	h.data <- in.Data
+	return nil, errors.New("store failed")
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	host := &fakeHost{data: make(chan string, 1)}
+	hostListener, err := pluginrpc.Listen(filepath.Join(dir, "host.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostServer := grpc.NewServer(pluginrpc.ServerOptions()...)
+	pluginrpc.RegisterHostServer(hostServer, host)
+	go hostServer.Serve(hostListener)
+	defer hostServer.Stop()
+
+	l, err := pluginrpc.Listen(filepath.Join(dir, "plugin.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	plugin := &fakePlugin{stopped: make(chan struct{})}
+	go serve(ctx, l, filepath.Join(dir, "host.sock"), plugin)
+
+	conn, err := pluginrpc.Dial(filepath.Join(dir, "plugin.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pluginrpc.NewPluginClient(conn)
+
+	version, err := client.Version(ctx, &pluginrpc.Empty{}, grpc.WaitForReady(true))
+	if err != nil || version.Version != "v1" {
+		t.Fatalf("Version() = %v, %v, want v1", version, err)
+	}
+	if _, err := client.Init(ctx, &pluginrpc.InitRequest{Name: "fake-a", Config: json.RawMessage(`{"key":"value"}`)}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if string(plugin.config) != `{"key":"value"}` {
+		t.Errorf("plugin config = %s, want the raw config", plugin.config)
+	}
+	if name := plugin.host.PluginName(); name != "fake-a" {
+		t.Errorf("PluginName() = %q, want fake-a", name)
+	}
+	// Start 返回插件上报的错误，这里是存储调用的错误
+	if _, err := client.Start(ctx, &pluginrpc.Empty{}); err == nil {
+		t.Errorf("Start() error = nil, want the error of the storage call")
+	}
+	if data := <-host.data; data != "ready" {
+		t.Errorf("stored data = %q, want ready", data)
+	}
+	status, err := client.Status(ctx, &pluginrpc.Empty{})
+	if err != nil || status.Name != "fake" || !status.Running {
+		t.Errorf("Status() = %+v, %v, want the status of the plugin", status, err)
+	}
+	if _, err := client.Stop(ctx, &pluginrpc.Empty{}); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	select {
+	case <-plugin.stopped:
+	default:
+		t.Errorf("plugin was not stopped")
+	}
+}
@@ -87,6 +87,26 @@ func (s *StorageConfig) StoreData(factory StorageFactory, data string) error {
 	}
 }
 
+// IsValid checks that the config of the storage type is set and valid
+func (s *StorageConfig) IsValid() error {
+	switch s.Type {
+	case StorageTypeInKube:
+		if s.InKube == nil {
+			return fmt.Errorf("inKube is required for storage type %s", s.Type)
+		}
+		if err := s.InKube.IsValid(); err != nil {
+			return fmt.Errorf("invalid inKube: %w", err)
+		}
+	case StorageTypeHTTPMetric:
+		if s.HTTPMetric == nil || s.HTTPMetric.MetricName == "" {
+			return fmt.Errorf("httpMetric.metricName is required for storage type %s", s.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported storage type: %q", s.Type)
+	}
+	return nil
+}
+
 func (t *TargetKubeObject) IsValid() error {
 	if t.Version == "" {
 		return fmt.Errorf("invalid version")
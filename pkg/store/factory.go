@@ -20,7 +20,7 @@ func NewStorageFactory(mgr api.SidecarManager) StorageFactory {
 		storageMap: make(map[StorageType]Storage),
 	}
 	f.storageMap[StorageTypeInKube] = &inKube{}
-	f.storageMap[StorageTypeHTTPMetric] = &promMetric{}
+	f.storageMap[StorageTypeHTTPMetric] = defaultPromMetric
 	f.manager = mgr
 	return f
 }
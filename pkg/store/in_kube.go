@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/magicsong/kidecar/api"
 	"github.com/magicsong/kidecar/pkg/info"
 	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
@@ -24,6 +26,8 @@ type inKube struct {
 	log     logr.Logger
 	dynamic dynamic.Interface
 	kubernetes.Interface
+	// patchFile 不为空时（离线模式）patch 被写入本地文件而不是发送给 API server
+	patchFile *localPatchFile
 }
 
 // IsInitialized implements Storage.
@@ -40,6 +44,10 @@ func (c *inKube) SetupWithManager(mgr api.SidecarManager) error {
 	c.log = mgr.GetLogger().WithName("in_kube")
 	c.dynamic = dynClient
 	c.Interface = mgr
+	if standalone, ok := mgr.(api.StandaloneManager); ok {
+		c.log.Info("standalone mode, patches are written to a local file", "path", standalone.PatchFile())
+		c.patchFile = &localPatchFile{path: standalone.PatchFile()}
+	}
 	return nil
 }
 
@@ -93,6 +101,16 @@ func (c *inKube) storeInCurrentPod(data string, config *InKubeConfig) error {
 	if err != nil {
 		return fmt.Errorf("failed to patch pod after mant retries: %w", err)
 	}
+	if c.patchFile != nil {
+		return c.patchFile.append(patchRecord{
+			Time:      time.Now(),
+			Resource:  corev1.SchemeGroupVersion.WithResource("pods").String(),
+			Namespace: currentPod.Namespace,
+			Name:      currentPod.Name,
+			PatchType: types.StrategicMergePatchType,
+			Patch:     patchBytes,
+		})
+	}
 	return nil
 }
 
@@ -123,6 +141,16 @@ func (c *inKube) storeInOtherObject(data string, myconfig *InKubeConfig) error {
 	patch := generatePatch(data, myconfig)
 	patchBytes, _ := json.Marshal(patch)
 	c.log.Info("patch inKube", "inKube", myconfig, "patch", string(patchBytes), "gvr", gvr)
+	if c.patchFile != nil {
+		return c.patchFile.append(patchRecord{
+			Time:      time.Now(),
+			Resource:  gvr.String(),
+			Namespace: myconfig.Target.Namespace,
+			Name:      myconfig.Target.Name,
+			PatchType: types.JSONPatchType,
+			Patch:     patchBytes,
+		})
+	}
 	_, err := c.dynamic.Resource(gvr).Namespace(myconfig.Target.Namespace).Patch(context.TODO(), myconfig.Target.Name, types.JSONPatchType, patchBytes, metav1.PatchOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to patch inKube: %w", err)
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// patchRecord is one patch the InKube storage would have sent to the API server
+type patchRecord struct {
+	Time      time.Time       `json:"time"`
+	Resource  string          `json:"resource"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	PatchType types.PatchType `json:"patchType"`
+	Patch     json.RawMessage `json:"patch"`
+}
+
+// localPatchFile records patches into a JSON array in a local file, it is used by the
+// InKube storage in standalone mode
+type localPatchFile struct {
+	path string
+	lock sync.Mutex
+}
+
+func (f *localPatchFile) append(record patchRecord) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var records []patchRecord
+	data, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read patch file %s: %w", f.path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &records); err != nil {
+			return fmt.Errorf("failed to parse patch file %s: %w", f.path, err)
+		}
+	}
+	records = append(records, record)
+	data, err = json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal patches: %w", err)
+	}
+	// 先写临时文件再重命名，避免读者看到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write patch file %s: %w", f.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write patch file %s: %w", f.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write patch file %s: %w", f.path, err)
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestLocalPatchFile(t *testing.T) {
+	f := &localPatchFile{path: filepath.Join(t.TempDir(), "patches.json")}
+	for _, state := range []string{"idle", "allocated"} {
+		err := f.append(patchRecord{
+			Resource:  "/v1, Resource=pods",
+			Name:      "game-server-0",
+			PatchType: types.StrategicMergePatchType,
+			Patch:     json.RawMessage(`{"metadata":{"annotations":{"state":"` + state + `"}}}`),
+		})
+		if err != nil {
+			t.Fatalf("append() error = %v", err)
+		}
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []patchRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("patch file is not a JSON array: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	patch := &bytes.Buffer{}
+	json.Compact(patch, records[1].Patch)
+	if patch.String() != `{"metadata":{"annotations":{"state":"allocated"}}}` {
+		t.Errorf("second patch = %s, want the allocated patch", patch)
+	}
+}
@@ -1,8 +1,8 @@
 package store
 
 import (
+	"errors"
 	"fmt"
-	"net/http"
 	"strconv"
 	"sync"
 
@@ -17,23 +17,51 @@ type promMetric struct {
 	metricsMu sync.Mutex
 }
 
+// defaultPromMetric is shared by all storage factories, so every plugin exports its
+// metrics through the same registry and /metrics handler
+var defaultPromMetric = &promMetric{}
+
 // IsInitialized implements Storage.
 func (p *promMetric) IsInitialized() bool {
+	p.metricsMu.Lock()
+	defer p.metricsMu.Unlock()
 	return p.registry != nil
 }
 
 // SetupWithManager implements Storage.
 func (p *promMetric) SetupWithManager(mgr api.SidecarManager) error {
+	p.metricsMu.Lock()
+	defer p.metricsMu.Unlock()
+	if p.registry != nil {
+		return nil
+	}
 	reg := prometheus.NewRegistry()
-	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
-
-	// 启动HTTP服务器
-	fmt.Println("Starting server at :8080")
+	// metrics 由 sidecar 的默认监听器对外提供
+	if err := mgr.RegisterHandler(api.DefaultListener, "/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{})); err != nil {
+		return fmt.Errorf("failed to register metrics handler: %w", err)
+	}
 	p.registry = reg
-	go http.ListenAndServe(":8080", nil)
 	return nil
 }
 
+// RegisterCollector exports c on the /metrics handler of the sidecar. A collector that is
+// already registered is replaced.
+func RegisterCollector(mgr api.SidecarManager, c prometheus.Collector) error {
+	if !defaultPromMetric.IsInitialized() {
+		if err := defaultPromMetric.SetupWithManager(mgr); err != nil {
+			return err
+		}
+	}
+	registry := defaultPromMetric.registry
+	err := registry.Register(c)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		registry.Unregister(registered.ExistingCollector)
+		err = registry.Register(c)
+	}
+	return err
+}
+
 // Store implements Storage.
 func (p *promMetric) Store(data string, config interface{}) error {
 	myconfig, ok := config.(*HTTPMetricConfig)
@@ -56,6 +84,9 @@ func (p *promMetric) getOrCreateGauge(config *HTTPMetricConfig) prometheus.Gauge
 	if gauge, exists := p.metrics[config.MetricName]; exists {
 		return gauge
 	}
+	if p.metrics == nil {
+		p.metrics = make(map[string]prometheus.Gauge)
+	}
 
 	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: config.MetricName,
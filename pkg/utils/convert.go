@@ -1,12 +1,23 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
 )
 
 func ConvertJsonObjectToStruct(source interface{}, target interface{}) error {
+	return convertJsonObjectToStruct(source, target, false)
+}
+
+// ConvertJsonObjectToStructStrict is like ConvertJsonObjectToStruct, but fails on fields of
+// source that target does not have
+func ConvertJsonObjectToStructStrict(source interface{}, target interface{}) error {
+	return convertJsonObjectToStruct(source, target, true)
+}
+
+func convertJsonObjectToStruct(source interface{}, target interface{}, strict bool) error {
 	if source == nil {
 		return fmt.Errorf("source is nil")
 	}
@@ -23,11 +34,15 @@ func ConvertJsonObjectToStruct(source interface{}, target interface{}) error {
 		return fmt.Errorf("target must be a pointer to a struct")
 	}
 	// then convert
-	bytes, err := json.Marshal(source)
+	data, err := json.Marshal(source)
 	if err != nil {
 		return fmt.Errorf("failed to marshal source: %w", err)
 	}
-	err = json.Unmarshal(bytes, target)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	err = decoder.Decode(target)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal: %w", err)
 	}
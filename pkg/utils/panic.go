@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is a recovered panic together with the stack trace where it happened
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Recover recovers a panic and passes it to handle as a *PanicError. It must be
+// deferred directly, e.g. `defer utils.Recover(func(err *utils.PanicError) {...})`.
+func Recover(handle func(err *PanicError)) {
+	if r := recover(); r != nil {
+		handle(&PanicError{Value: r, Stack: string(debug.Stack())})
+	}
+}
@@ -0,0 +1,42 @@
+// Package version holds the build information of kidecar, which is injected at build time:
+//
+//	go build -ldflags "-X github.com/magicsong/kidecar/pkg/version.Version=v0.1.0 \
+//		-X github.com/magicsong/kidecar/pkg/version.GitCommit=$(git rev-parse --short HEAD) \
+//		-X github.com/magicsong/kidecar/pkg/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// 以下变量在构建时通过 -ldflags -X 注入
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info is the build information of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("kidecar %s (commit %s, built %s, %s %s)", i.Version, i.GitCommit, i.BuildDate, i.GoVersion, i.Platform)
+}